@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// crashesCommand returns the "crashes" command, listing the crash history of a server
+func crashesCommand() *cobra.Command {
+	var limit int
+	var crashesCmd = &cobra.Command{
+		Use:   "crashes <server>",
+		Short: "Lists the last crashes of a server, read from its crash reports",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			serverID, err := setupCLI(args[0])
+			if err != nil {
+				fmt.Println("✘", err)
+				os.Exit(1)
+			}
+			crashes, err := db.GetServerCrashes(serverID, limit)
+			if err != nil {
+				fmt.Println("✘", err)
+				os.Exit(1)
+			}
+
+			if len(crashes) == 0 {
+				fmt.Println("♟ No crash saved for this server.")
+			}
+			for _, crash := range crashes {
+				fmt.Printf("%s  %s\n  %s\n", crash.Date, crash.File, crash.Description)
+				if crash.Exception != "" {
+					fmt.Println("  " + crash.Exception)
+				}
+				if crash.SuspectedMods != "" {
+					fmt.Println("  Suspected mods : " + crash.SuspectedMods)
+				}
+			}
+		},
+	}
+	crashesCmd.Flags().IntVarP(&limit, "limit", "n", 10, "Number of crashes shown")
+
+	return crashesCmd
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/chatbridge"
+	"github.com/Corentin-cott/ServerSentinel/internal/commands"
 	"github.com/Corentin-cott/ServerSentinel/internal/console"
 	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/docker"
 	periodic "github.com/Corentin-cott/ServerSentinel/internal/events"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+	"github.com/Corentin-cott/ServerSentinel/internal/roster"
+	"github.com/Corentin-cott/ServerSentinel/internal/schedule"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+	"github.com/Corentin-cott/ServerSentinel/internal/status"
 	"github.com/Corentin-cott/ServerSentinel/internal/triggers"
 	"github.com/spf13/cobra"
 )
@@ -29,6 +41,10 @@ func main() {
 
 	// Add commands to root
 	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(serverCommand())
+	rootCmd.AddCommand(sessionCommand())
+	rootCmd.AddCommand(crashesCommand())
+	rootCmd.AddCommand(scheduleCommand())
 
 	// Execute CLI
 	if err := rootCmd.Execute(); err != nil {
@@ -47,6 +63,10 @@ func runDaemon(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// The Discord API URL can be changed to use a local stub
+	discord.SetBaseURL(config.AppConfig.DiscordAPIURL)
+	docker.SetSocketPath(config.AppConfig.Docker.Socket)
+
 	if !config.AppConfig.PeriodicEvents.ServersCheckEnabled {
 		fmt.Println("♟ Periodic task : Servers check disabled.")
 	}
@@ -71,6 +91,68 @@ func runDaemon(cmd *cobra.Command, args []string) {
 		log.Fatalf("FATAL ERROR TESTING DATABASE CONNECTION: %v", err)
 	}
 
+	// Start the outbox, the Discord messages not delivered before the last stop are sent again
+	err = outbox.Start(config.AppConfig.OutboxDir)
+	if err != nil {
+		fmt.Println("✘ Error while starting the outbox, messages will be sent directly:", err)
+	}
+
+	// Start the Discord slash commands endpoint
+	if config.AppConfig.Interactions.Enabled {
+		go func() {
+			err := commands.Start()
+			if err != nil {
+				fmt.Println("✘ Error while starting the Discord interactions endpoint:", err)
+			}
+		}()
+	} else {
+		fmt.Println("♟ Discord slash commands disabled.")
+	}
+
+	// Start the Discord to game chat bridge
+	if config.AppConfig.ChatBridge.Enabled {
+		go func() {
+			err := chatbridge.Start()
+			if err != nil {
+				fmt.Println("✘ Error while starting the chat bridge:", err)
+			}
+		}()
+	} else {
+		fmt.Println("♟ Discord to game chat bridge disabled.")
+	}
+
+	// Start the status messages, edited in place in the server status channel
+	if config.AppConfig.StatusMessage.Enabled {
+		go func() {
+			err := status.Start()
+			if err != nil {
+				fmt.Println("✘ Error while starting the status messages:", err)
+			}
+		}()
+	} else {
+		fmt.Println("♟ Discord status messages disabled.")
+	}
+
+	// Start the scheduled restarts of the servers
+	go func() {
+		err := schedule.Start()
+		if err != nil {
+			fmt.Println("✘ Error while starting the scheduled restarts:", err)
+		}
+	}()
+
+	// Check the online players of each server against the servers themselves
+	go roster.StartReconciliation(time.Duration(config.AppConfig.RosterReconcileSec) * time.Second)
+	fmt.Println("✔ Roster reconciliation started, interval is set to", config.AppConfig.RosterReconcileSec, "seconds.")
+
+	// Start the health check of the servers
+	if config.AppConfig.PeriodicEvents.ServersCheckEnabled {
+		go periodic.StartServerCheck(time.Duration(config.AppConfig.PeriodicEvents.ServersCheckIntervalSec) * time.Second)
+		fmt.Println("✔ Server check started, interval is set to", config.AppConfig.PeriodicEvents.ServersCheckIntervalSec, "seconds.")
+	} else {
+		fmt.Println("♟ Server check is disabled.")
+	}
+
 	// Start the periodic service
 	go func() {
 		err := periodic.StartPeriodicTask(config.AppConfig.PeriodicEventsMin)
@@ -90,8 +172,103 @@ func runDaemon(cmd *cobra.Command, args []string) {
 	// Create a list of triggers and create a wait group
 	// triggersList := triggers.GetTriggers([]string{"MinecraftServerStarted", "MinecraftServerStopped", "PlayerJoinedMinecraftServer"}) // Example with selected triggers
 	triggersList := triggers.GetTriggers([]string{})
+
+	// Add the triggers declared in the rules file
+	ruleTriggers, err := triggers.LoadRuleTriggers(config.AppConfig.TriggersFile)
+	if err != nil {
+		fmt.Println("✘ Error while loading the triggers rules file:", err)
+	} else if config.AppConfig.TriggersFile != "" {
+		fmt.Println("✔ Rules loaded : ", len(ruleTriggers), " triggers.")
+	}
+	triggersList = append(triggersList, ruleTriggers...)
 	fmt.Println("✔ Triggers loaded : ", len(triggersList), " triggers.")
-	console.ProcessLogFiles("/opt/serversentinel/serverslog/", triggersList)
+	// Load the position of each log file, so the lines written while the daemon was stopped are read
+	err = console.LoadCheckpoints()
+	if err != nil {
+		fmt.Println("✘ Error while loading the log files checkpoints:", err)
+	}
+
+	// Reopen the sessions closed when the daemon stopped, before the lines written meanwhile close them at their real time
+	reopenClosedSessions()
+
+	// Close the player sessions and save the checkpoints when the daemon is stopped
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		stopDaemon()
+		os.Exit(0)
+	}()
+
+	console.ProcessLogFiles(console.DefaultLogDir, triggersList)
+
+	stopDaemon()
+}
+
+// stopDaemon closes what must be closed before the daemon exits
+func stopDaemon() {
+	closed, err := db.CloseAllPlayerSessions()
+	if err != nil {
+		fmt.Println("✘ Error while closing the player sessions:", err)
+	} else if len(closed) > 0 {
+		fmt.Printf("♟ %d player sessions closed.\n", len(closed))
+	}
+	// The closed sessions are kept even when there's none, so an old list is never reopened
+	if err == nil {
+		if err := writeClosedSessions(closed); err != nil {
+			fmt.Println("✘ Error while writing the closed sessions file:", err)
+		}
+	}
+
+	err = console.SaveCheckpoints()
+	if err != nil {
+		fmt.Println("✘ Error while saving the log files checkpoints:", err)
+	}
+	services.CloseRconConnections()
 
 	fmt.Println("♦ Server Sentinel daemon stopped.")
 }
+
+// reopenClosedSessions reopens the sessions closed by the last stop of the daemon
+func reopenClosedSessions() {
+	content, err := os.ReadFile(config.AppConfig.ClosedSessionsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println("✘ Error while reading the closed sessions file:", err)
+		}
+		return
+	}
+	var ids []int
+	if err := json.Unmarshal(content, &ids); err != nil {
+		fmt.Println("✘ Error while reading the closed sessions file:", err)
+		return
+	}
+
+	reopened, err := db.ReopenPlayerSessions(ids)
+	if err != nil {
+		fmt.Println("✘ Error while reopening the player sessions:", err)
+		return
+	}
+	if reopened > 0 {
+		fmt.Printf("♟ %d player sessions closed by the last stop reopened.\n", reopened)
+	}
+	if err := writeClosedSessions(nil); err != nil {
+		fmt.Println("✘ Error while writing the closed sessions file:", err)
+	}
+}
+
+// writeClosedSessions writes the IDs of the sessions closed by the stop of the daemon, through a temporary file
+func writeClosedSessions(ids []int) error {
+	if ids == nil {
+		ids = []int{}
+	}
+	content, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	path := config.AppConfig.ClosedSessionsFile
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCommand returns the "schedule" command, listing, postponing and cancelling the scheduled restarts
+func scheduleCommand() *cobra.Command {
+	var scheduleCmd = &cobra.Command{
+		Use:   "schedule",
+		Short: "Lists, postpones or cancels the scheduled restarts of the servers",
+	}
+
+	scheduleCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the next scheduled restart of each server",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := loadCLIConfig()
+			if err == nil {
+				err = db.ConnectToDatabase()
+			}
+			var restarts []schedule.PendingRestart
+			if err == nil {
+				restarts, err = schedule.ListPending()
+			}
+			if err != nil {
+				fmt.Println("✘", err)
+				os.Exit(1)
+			}
+
+			if len(restarts) == 0 {
+				fmt.Println("♟ No scheduled restart.")
+			}
+			for _, restart := range restarts {
+				name := strconv.Itoa(restart.ServerID)
+				if server, exists := db.GetServerConfigById(restart.ServerID); exists {
+					name = server.Name
+				}
+				fmt.Println(name + " : " + formatPendingRestart(restart))
+			}
+		},
+	})
+
+	scheduleCmd.AddCommand(&cobra.Command{
+		Use:   "postpone <server> <minutes>",
+		Short: "Postpones the next scheduled restart of a server",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			minutes, err := strconv.Atoi(args[1])
+			if err != nil || minutes <= 0 {
+				fmt.Println("✘ ERROR: INVALID NUMBER OF MINUTES", args[1])
+				os.Exit(1)
+			}
+			runScheduleChange(args[0], func(serverID int) (schedule.PendingRestart, error) {
+				return schedule.Postpone(serverID, time.Duration(minutes)*time.Minute)
+			})
+		},
+	})
+
+	scheduleCmd.AddCommand(&cobra.Command{
+		Use:   "cancel <server>",
+		Short: "Cancels the next scheduled restart of a server, the following ones still happen",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runScheduleChange(args[0], schedule.Cancel)
+		},
+	})
+
+	return scheduleCmd
+}
+
+// runScheduleChange changes the pending restart of a server and shows it
+func runScheduleChange(serverArg string, change func(serverID int) (schedule.PendingRestart, error)) {
+	serverID, err := setupCLI(serverArg)
+	var restart schedule.PendingRestart
+	if err == nil {
+		restart, err = change(serverID)
+	}
+	if err != nil {
+		fmt.Println("✘", err)
+		os.Exit(1)
+	}
+	fmt.Println("✔ Restart of " + serverArg + " : " + formatPendingRestart(restart))
+}
+
+// formatPendingRestart returns the time of a pending restart, with its postponement or cancellation
+func formatPendingRestart(restart schedule.PendingRestart) string {
+	line := restart.RestartAt.Format("02/01/2006 15:04")
+	switch {
+	case restart.Cancelled:
+		line += " (cancelled)"
+	case !restart.RestartAt.Equal(restart.Occurrence):
+		line += " (postponed from " + restart.Occurrence.Format("15:04") + ")"
+	}
+	return line
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/docker"
+	"github.com/Corentin-cott/ServerSentinel/internal/lifecycle"
+	"github.com/spf13/cobra"
+)
+
+// serverCommand returns the "server" command, controlling the containers of the servers
+func serverCommand() *cobra.Command {
+	var serverCmd = &cobra.Command{
+		Use:   "server",
+		Short: "Starts, stops, restarts or kills the container of a server",
+	}
+
+	actions := []struct {
+		name  string
+		short string
+		run   func(serverID int) error
+	}{
+		{"start", "Starts the container of a server", lifecycle.StartServer},
+		{"stop", "Saves and stops a server, then its container", lifecycle.StopServer},
+		{"restart", "Saves and stops a server, then starts it again", lifecycle.RestartServer},
+		{"kill", "Kills the container of a server without saving it", lifecycle.KillServer},
+	}
+	for _, action := range actions {
+		serverCmd.AddCommand(&cobra.Command{
+			Use:   action.name + " <server>",
+			Short: action.short,
+			Args:  cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				serverID, err := setupCLI(args[0])
+				if err == nil {
+					err = action.run(serverID)
+				}
+				if err != nil {
+					fmt.Println("✘", err)
+					os.Exit(1)
+				}
+			},
+		})
+	}
+
+	return serverCmd
+}
+
+// setupCLI loads the configuration and connects to the database for a CLI command, and returns the ID of the server given
+// The server is a name of the servers section, or an ID of the serveurs table
+func setupCLI(serverArg string) (int, error) {
+	if err := loadCLIConfig(); err != nil {
+		return 0, err
+	}
+
+	if err := db.ConnectToDatabase(); err != nil {
+		return 0, fmt.Errorf("ERROR TESTING DATABASE CONNECTION: %v", err)
+	}
+
+	if server, exists := config.GetServerConfigByName(serverArg); exists {
+		if serverID := db.ResolveServerID(server); serverID > 0 {
+			return serverID, nil
+		}
+		return 0, fmt.Errorf("ERROR: SERVER %s IS NOT IN THE SERVEURS TABLE", serverArg)
+	}
+	if serverID, err := strconv.Atoi(serverArg); err == nil {
+		return serverID, nil
+	}
+	return 0, fmt.Errorf("ERROR: SERVER %s NOT FOUND", serverArg)
+}
+
+// loadCLIConfig loads the configuration for a CLI command
+func loadCLIConfig() error {
+	if err := config.LoadConfig("/opt/serversentinel/config.json"); err != nil {
+		return fmt.Errorf("ERROR LOADING CONFIG JSON FILE: %v", err)
+	}
+	discord.SetBaseURL(config.AppConfig.DiscordAPIURL)
+	docker.SetSocketPath(config.AppConfig.Docker.Socket)
+	return nil
+}
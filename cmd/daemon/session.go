@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/tmux"
+	"github.com/spf13/cobra"
+)
+
+// Time given to a server to stop after its stop command before its session is killed
+const sessionStopDelay = 60 * time.Second
+
+// sessionCommand returns the "session" command, controlling the tmux sessions of the servers
+func sessionCommand() *cobra.Command {
+	var sessionCmd = &cobra.Command{
+		Use:   "session",
+		Short: "Starts, stops and sends commands to the tmux sessions of the servers",
+	}
+
+	sessionCmd.AddCommand(&cobra.Command{
+		Use:   "start <server>",
+		Short: "Starts a server in its tmux session, its output is written to its log file",
+		Args:  cobra.ExactArgs(1),
+		Run: runSessionCommand(func(server models.ServerConfig, args []string) error {
+			if err := tmux.StartServer(server); err != nil {
+				return err
+			}
+			fmt.Printf("✔ Server %s started in session %s.\n", server.Name, tmux.SessionName(server))
+			return nil
+		}),
+	})
+
+	sessionCmd.AddCommand(&cobra.Command{
+		Use:   "stop <server>",
+		Short: "Sends the stop command of a server, then kills its session if it is still running",
+		Args:  cobra.ExactArgs(1),
+		Run: runSessionCommand(func(server models.ServerConfig, args []string) error {
+			if err := tmux.StopServer(server, sessionStopDelay); err != nil {
+				return err
+			}
+			fmt.Printf("✔ Session %s of server %s stopped.\n", tmux.SessionName(server), server.Name)
+			return nil
+		}),
+	})
+
+	sessionCmd.AddCommand(&cobra.Command{
+		Use:   "send <server> <command...>",
+		Short: "Types a command in the console of a server and shows the last lines of its session",
+		Args:  cobra.MinimumNArgs(2),
+		Run: runSessionCommand(func(server models.ServerConfig, args []string) error {
+			name := tmux.SessionName(server)
+			if !tmux.HasSession(name) {
+				return fmt.Errorf("ERROR: SESSION %s OF SERVER %s IS NOT RUNNING", name, server.Name)
+			}
+			if err := tmux.SendKeys(name, strings.Join(args, " ")); err != nil {
+				return err
+			}
+
+			time.Sleep(500 * time.Millisecond) // Time for the server to answer
+			pane, err := tmux.CapturePane(name, 10)
+			if err != nil {
+				return err
+			}
+			fmt.Println(pane)
+			return nil
+		}),
+	})
+
+	sessionCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the tmux sessions and the servers running in them",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := loadCLIConfig(); err != nil {
+				fmt.Println("✘", err)
+				os.Exit(1)
+			}
+			sessions, err := tmux.ListSessions()
+			if err != nil {
+				fmt.Println("✘", err)
+				os.Exit(1)
+			}
+
+			servers := map[string]string{} // Session name -> server name
+			for _, server := range config.AppConfig.Servers {
+				servers[tmux.SessionName(server)] = server.Name
+			}
+			if len(sessions) == 0 {
+				fmt.Println("♟ No tmux session running.")
+			}
+			for _, session := range sessions {
+				line := session.Name + " (since " + session.Created.Format("02/01/2006 15:04:05")
+				if session.Attached {
+					line += ", attached"
+				}
+				line += ")"
+				if serverName, exists := servers[session.Name]; exists {
+					line += " : server " + serverName
+				}
+				fmt.Println(line)
+			}
+		},
+	})
+
+	return sessionCmd
+}
+
+// runSessionCommand returns the run function of a session command taking a server name as first argument
+func runSessionCommand(action func(server models.ServerConfig, args []string) error) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		err := loadCLIConfig()
+		if err == nil {
+			server, exists := config.GetServerConfigByName(args[0])
+			if !exists {
+				err = fmt.Errorf("ERROR: SERVER %s NOT FOUND", args[0])
+			} else {
+				err = action(server, args[1:])
+			}
+		}
+		if err != nil {
+			fmt.Println("✘", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -4,23 +4,44 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/Corentin-cott/ServerSentinel/internal/models"
 )
 
 // Config is a struct that contains every configuration needed for ServeurSentinel
 type Config struct {
-	Bots              map[string]models.BotConfig            `json:"bots"`
-	DiscordChannels   models.DiscordChannels                 `json:"discordChannels"`
-	DiscordWebhooks   map[string]models.DiscordWebhookConfig `json:"discordWebhooks"`
-	DB                models.DatabaseConfig                  `json:"db"`
-	PeriodicEvents    models.PeriodicEventsConfig            `json:"periodicEvents"`
-	LogPath           string                                 `json:"logPath"`
-	PeriodicEventsMin int                                    `json:"periodicEventsMin"`
+	Bots               map[string]models.BotConfig            `json:"bots"`
+	DiscordChannels    models.DiscordChannels                 `json:"discordChannels"`
+	DiscordWebhooks    map[string]models.DiscordWebhookConfig `json:"discordWebhooks"`
+	DiscordAPIURL      string                                 `json:"discordAPIURL"`
+	Docker             models.DockerConfig                    `json:"docker"`
+	DB                 models.DatabaseConfig                  `json:"db"`
+	PeriodicEvents     models.PeriodicEventsConfig            `json:"periodicEvents"`
+	LogPath            string                                 `json:"logPath"`
+	PeriodicEventsMin  int                                    `json:"periodicEventsMin"`
+	Servers            []models.ServerConfig                  `json:"servers"`
+	TriggersFile       string                                 `json:"triggersFile"`
+	CheckpointsFile    string                                 `json:"checkpointsFile"`
+	MaxCatchUpMin      int                                    `json:"maxCatchUpMin"`
+	OutboxDir          string                                 `json:"outboxDir"`
+	Interactions       models.InteractionsConfig              `json:"interactions"`
+	ChatBridge         models.ChatBridgeConfig                `json:"chatBridge"`
+	RosterReconcileSec int                                    `json:"rosterReconcileSec"`
+	StatusMessage      models.StatusMessageConfig             `json:"statusMessage"`
+	StoppedServersFile string                                 `json:"stoppedServersFile"`
+	SchedulesFile      string                                 `json:"schedulesFile"`
+	ClosedSessionsFile string                                 `json:"closedSessionsFile"`
 }
 
 var AppConfig Config
 
+var (
+	bridgeGroups      = map[string]string{} // Server name -> bridge group set at runtime
+	bridgeGroupsMutex sync.RWMutex
+)
+
 // LoadConfig loads the configuration from a JSON file
 func LoadConfig(configPath string) error {
 	file, err := os.Open(configPath)
@@ -35,6 +56,132 @@ func LoadConfig(configPath string) error {
 		return fmt.Errorf("error decoding configuration: %v", err)
 	}
 
+	// Without a servers section, we keep the old 1.log / 2.log / 3.log mapping
+	if len(AppConfig.Servers) == 0 {
+		AppConfig.Servers = legacyServers()
+		fmt.Println("♟ No servers section in configuration, using the default 1.log / 2.log / 3.log mapping.")
+	}
+
+	if AppConfig.CheckpointsFile == "" {
+		AppConfig.CheckpointsFile = "/opt/serversentinel/checkpoints.json"
+	}
+	if AppConfig.ClosedSessionsFile == "" {
+		AppConfig.ClosedSessionsFile = "/opt/serversentinel/closed_sessions.json"
+	}
+
+	if AppConfig.OutboxDir == "" {
+		AppConfig.OutboxDir = "/opt/serversentinel/outbox"
+	}
+
+	if AppConfig.Interactions.ListenAddress == "" {
+		AppConfig.Interactions.ListenAddress = ":8080"
+	}
+
+	if AppConfig.ChatBridge.PollIntervalSec <= 0 {
+		AppConfig.ChatBridge.PollIntervalSec = 2
+	}
+	if AppConfig.ChatBridge.IdlePollIntervalSec <= 0 {
+		AppConfig.ChatBridge.IdlePollIntervalSec = 10
+	}
+	if len(AppConfig.ChatBridge.Channels) == 0 && AppConfig.DiscordChannels.MinecraftChatChannelID != "" {
+		AppConfig.ChatBridge.Channels = []models.ChatBridgeChannel{{ChannelID: AppConfig.DiscordChannels.MinecraftChatChannelID}}
+	}
+
+	if AppConfig.StatusMessage.ChannelID == "" {
+		AppConfig.StatusMessage.ChannelID = AppConfig.DiscordChannels.ServerStatusChannelID
+	}
+	if AppConfig.StatusMessage.IntervalSec <= 0 {
+		AppConfig.StatusMessage.IntervalSec = 60
+	}
+	if AppConfig.StatusMessage.MessagesFile == "" {
+		AppConfig.StatusMessage.MessagesFile = "/opt/serversentinel/status_messages.json"
+	}
+
+	if AppConfig.Docker.DataDestination == "" {
+		AppConfig.Docker.DataDestination = "/data"
+	}
+
+	if AppConfig.PeriodicEvents.ServersCheckIntervalSec <= 0 {
+		AppConfig.PeriodicEvents.ServersCheckIntervalSec = 60
+	}
+
+	if AppConfig.SchedulesFile == "" {
+		AppConfig.SchedulesFile = "/opt/serversentinel/scheduled_restarts.json"
+	}
+	if AppConfig.StoppedServersFile == "" {
+		AppConfig.StoppedServersFile = "/opt/serversentinel/stopped_servers.json"
+	}
+
+	if AppConfig.RosterReconcileSec <= 0 {
+		AppConfig.RosterReconcileSec = 60
+	}
+
 	fmt.Printf("✔ Configuration loaded successfully\n")
 	return nil
 }
+
+// legacyServers returns the server registry used before the servers section existed
+func legacyServers() []models.ServerConfig {
+	return []models.ServerConfig{
+		{Name: "primary", LogFile: "1.log", Role: "primary", Webhook: "primary", BridgeGroup: "main"},
+		{Name: "secondary", LogFile: "2.log", Role: "secondary", Webhook: "secondary", BridgeGroup: "main"},
+		{Name: "partner", LogFile: "3.log", Role: "partner", Webhook: "partner", Disabled: true},
+	}
+}
+
+// GetServerConfigByLogFile returns the server registered for a log file
+func GetServerConfigByLogFile(logFilePath string) (models.ServerConfig, bool) {
+	for _, server := range AppConfig.Servers {
+		if server.LogFile == logFilePath || server.LogFile == filepath.Base(logFilePath) {
+			return server, true
+		}
+	}
+	return models.ServerConfig{}, false
+}
+
+// GetServerConfigByName returns the server registered with the given name
+func GetServerConfigByName(name string) (models.ServerConfig, bool) {
+	for _, server := range AppConfig.Servers {
+		if server.Name == name {
+			return server, true
+		}
+	}
+	return models.ServerConfig{}, false
+}
+
+// GetBridgeGroup returns the bridge group of a server, with the changes made at runtime
+func GetBridgeGroup(server models.ServerConfig) string {
+	bridgeGroupsMutex.RLock()
+	defer bridgeGroupsMutex.RUnlock()
+
+	if group, changed := bridgeGroups[server.Name]; changed {
+		return group
+	}
+	return server.BridgeGroup
+}
+
+// SetBridgeGroup changes the bridge group of a server until the next restart, an empty group removes the server from its group
+func SetBridgeGroup(serverName string, group string) error {
+	if _, exists := GetServerConfigByName(serverName); !exists {
+		return fmt.Errorf("ERROR: SERVER %s NOT FOUND IN THE SERVERS SECTION", serverName)
+	}
+
+	bridgeGroupsMutex.Lock()
+	defer bridgeGroupsMutex.Unlock()
+	bridgeGroups[serverName] = group
+	return nil
+}
+
+// GetBridgeMembers returns the servers of a bridge group
+func GetBridgeMembers(group string) []models.ServerConfig {
+	var members []models.ServerConfig
+	if group == "" {
+		return members
+	}
+	for _, server := range AppConfig.Servers {
+		if GetBridgeGroup(server) == group {
+			members = append(members, server)
+		}
+	}
+	return members
+}
@@ -0,0 +1,405 @@
+package chatbridge
+
+// The chat bridge relays the messages written in the Discord chat channels to the bridged Minecraft servers with tellraw
+// The channels are read with the REST API, so the bot needs the Message Content intent to see the messages
+// Each read is a request counted in the global rate limit of the bot, shared with the outbox, so a single loop reads each channel once
+// per interval, and the interval grows while the channels are quiet
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+const (
+	cacheDuration    = 5 * time.Minute // Time during which the members and roles of a guild are kept
+	maxMessageLength = 256             // Maximum length of a message relayed in game
+	discordColor     = "#5865F2"       // Colour of the [Discord] prefix in game
+)
+
+// discordUser is the author of a Discord message
+type discordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Bot        bool   `json:"bot"`
+}
+
+// discordMessage is the part of a Discord message relayed in game
+type discordMessage struct {
+	ID          string        `json:"id"`
+	Type        int           `json:"type"`
+	Author      discordUser   `json:"author"`
+	Content     string        `json:"content"`
+	WebhookID   string        `json:"webhook_id"`
+	Mentions    []discordUser `json:"mentions"`
+	Attachments []struct {
+		Filename string `json:"filename"`
+		URL      string `json:"url"`
+	} `json:"attachments"`
+	Embeds []struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"embeds"`
+	ReferencedMessage *discordMessage `json:"referenced_message"`
+}
+
+// guildMember is a member of a guild, with the time it was read
+type guildMember struct {
+	Nick   string   `json:"nick"`
+	Roles  []string `json:"roles"`
+	readAt time.Time
+}
+
+// guildRoles are the roles of a guild by ID, with the time they were read
+type guildRoles struct {
+	roles  map[string]guildRole
+	readAt time.Time
+}
+
+// guildRole is a role of a guild
+type guildRole struct {
+	ID       string `json:"id"`
+	Color    int    `json:"color"`
+	Position int    `json:"position"`
+}
+
+// bridgedChannel is a chat channel read by the bridge, with the bridge groups its messages are relayed to
+type bridgedChannel struct {
+	id     string
+	groups []string // An empty group relays the messages to every bridged server
+	lastID string   // ID of the last message read
+}
+
+// The caches are only used by the polling loop, so they don't need a mutex
+var (
+	channelGuilds = map[string]string{}      // Channel ID -> guild ID
+	members       = map[string]guildMember{} // Guild ID + user ID -> member
+	roles         = map[string]guildRoles{}  // Guild ID -> roles
+)
+
+// Start reads the chat channels and relays their new messages to the bridged servers, it never returns without an error
+func Start() error {
+	settings := config.AppConfig.ChatBridge
+	botToken := config.AppConfig.Bots[settings.Bot].BotToken
+	if botToken == "" {
+		return fmt.Errorf("ERROR: BOT TOKEN NOT SET FOR CHAT BRIDGE BOT %s", settings.Bot)
+	}
+	if len(settings.Channels) == 0 {
+		return fmt.Errorf("ERROR: NO CHAT BRIDGE CHANNEL SET")
+	}
+
+	// Only the messages written after the start are relayed
+	channels := bridgedChannels(settings.Channels)
+	for _, channel := range channels {
+		channel.lastID = latestMessageID(botToken, channel.id)
+	}
+	fmt.Printf("✔ Chat bridge started on %d channels.\n", len(channels))
+
+	interval := time.Duration(settings.PollIntervalSec) * time.Second
+	for {
+		time.Sleep(interval)
+
+		relayed := false
+		for _, channel := range channels {
+			if channel.lastID == "" {
+				// Without a starting point the whole history would be read
+				channel.lastID = latestMessageID(botToken, channel.id)
+				continue
+			}
+
+			messages, err := readMessages(botToken, channel.id, channel.lastID)
+			if err != nil {
+				fmt.Println("✘ Chat bridge : error while reading channel "+channel.id+":", err)
+				continue
+			}
+			for _, message := range messages {
+				channel.lastID = message.ID
+				relayMessage(botToken, channel, message)
+				relayed = true
+			}
+		}
+		interval = nextInterval(interval, relayed, settings)
+	}
+}
+
+// bridgedChannels groups the configured channels by channel ID, so a channel set for several bridge groups is read once
+func bridgedChannels(configured []models.ChatBridgeChannel) []*bridgedChannel {
+	var channels []*bridgedChannel
+	byID := map[string]*bridgedChannel{}
+	for _, entry := range configured {
+		channel, exists := byID[entry.ChannelID]
+		if !exists {
+			channel = &bridgedChannel{id: entry.ChannelID}
+			byID[entry.ChannelID] = channel
+			channels = append(channels, channel)
+		}
+		if !slices.Contains(channel.groups, entry.BridgeGroup) {
+			channel.groups = append(channel.groups, entry.BridgeGroup)
+		}
+	}
+	return channels
+}
+
+// nextInterval returns the delay before the next read, doubled after each read without message up to the idle interval
+func nextInterval(interval time.Duration, relayed bool, settings models.ChatBridgeConfig) time.Duration {
+	base := time.Duration(settings.PollIntervalSec) * time.Second
+	idle := time.Duration(settings.IdlePollIntervalSec) * time.Second
+	if relayed || idle <= base {
+		return base
+	}
+	return min(interval*2, idle)
+}
+
+// latestMessageID returns the ID of the last message of a channel, an empty string if it can't be read
+func latestMessageID(botToken string, channelID string) string {
+	body, err := discord.DefaultClient.Do("GET", "/channels/"+channelID+"/messages?limit=1", botToken, nil)
+	if err != nil {
+		fmt.Println("✘ Chat bridge : error while reading channel "+channelID+":", err)
+		return ""
+	}
+
+	var messages []discordMessage
+	if err := json.Unmarshal(body, &messages); err != nil {
+		fmt.Println("✘ Chat bridge : error while reading channel "+channelID+":", err)
+		return ""
+	}
+	if len(messages) == 0 {
+		return "0" // Empty channel, every message is new
+	}
+	return messages[0].ID
+}
+
+// readMessages returns the messages of a channel written after the given message, oldest first
+func readMessages(botToken string, channelID string, afterID string) ([]discordMessage, error) {
+	body, err := discord.DefaultClient.Do("GET", "/channels/"+channelID+"/messages?limit=50&after="+afterID, botToken, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []discordMessage
+	if err := json.Unmarshal(body, &messages); err != nil {
+		return nil, fmt.Errorf("ERROR WHILE READING DISCORD MESSAGES: %v", err)
+	}
+
+	// Discord returns the newest messages first, IDs grow with time
+	sort.Slice(messages, func(i, j int) bool {
+		first, _ := strconv.ParseUint(messages[i].ID, 10, 64)
+		second, _ := strconv.ParseUint(messages[j].ID, 10, 64)
+		return first < second
+	})
+	return messages, nil
+}
+
+// relayMessage sends a Discord message to the servers bridged with its channel
+func relayMessage(botToken string, channel *bridgedChannel, message discordMessage) {
+	// Messages from bots and webhooks are the ones the daemon posts, relaying them would echo the game chat
+	if message.Author.Bot || message.WebhookID != "" {
+		return
+	}
+	if message.Type != 0 && message.Type != 19 { // Only the normal messages and the replies
+		return
+	}
+
+	name, color := authorDisplay(botToken, channel.id, message.Author)
+	components := messageComponents(message, name, color, authorName(message.ReferencedMessage))
+	command, err := services.TellrawCommand("@a", components...)
+	if err != nil {
+		fmt.Println("✘ Chat bridge :", err)
+		return
+	}
+
+	for _, server := range config.AppConfig.Servers {
+		group := config.GetBridgeGroup(server)
+		if group == "" || !(slices.Contains(channel.groups, "") || slices.Contains(channel.groups, group)) {
+			continue
+		}
+		game, err := db.GetServerGameById(db.ResolveServerID(server))
+		if err != nil {
+			continue
+		}
+
+		switch game {
+		case "Minecraft":
+			host, port, password := db.GetRconAddress(server)
+			_, err = services.SendRconToMinecraftServer(host, port, password, command)
+		case "Palworld":
+			err = db.GetPalworldClient(server).Announce(services.PlainText(components...))
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Println("✘ Chat bridge : error while sending message to "+server.Name+":", err)
+			continue
+		}
+		fmt.Println("✔ Discord message of " + name + " relayed to " + server.Name + ".")
+	}
+}
+
+// messageComponents creates the text components showing a Discord message in game
+func messageComponents(message discordMessage, name string, color string, replyTo string) []services.TextComponent {
+	components := []services.TextComponent{
+		services.Text("[Discord] ").WithColor(discordColor),
+		services.Text("<" + name + ">").WithColor(color).WithHoverText("@" + message.Author.Username),
+	}
+
+	if message.ReferencedMessage != nil {
+		components = append(components, services.Text(" ↪ "+replyTo).WithColor("gray").WithItalic().
+			WithHoverText(shorten(messageText(*message.ReferencedMessage))))
+	}
+
+	if content := shorten(messageText(message)); content != "" {
+		components = append(components, services.Text(" "+content))
+	}
+
+	for _, attachment := range message.Attachments {
+		components = append(components, services.Text(" ["+attachment.Filename+"]").WithColor("aqua").WithUnderline().
+			WithClick(services.ClickOpenURL, attachment.URL).WithHoverText("Ouvrir "+attachment.Filename))
+	}
+
+	return components
+}
+
+// messageText returns the text of a message, with the mentions replaced by the names
+// The messages of the daemon are embeds, their text is the title and the description
+func messageText(message discordMessage) string {
+	text := message.Content
+	for _, user := range message.Mentions {
+		name := "@" + user.Username
+		text = strings.ReplaceAll(text, "<@"+user.ID+">", name)
+		text = strings.ReplaceAll(text, "<@!"+user.ID+">", name)
+	}
+	if text == "" && len(message.Embeds) > 0 {
+		text = strings.TrimSpace(message.Embeds[0].Title + " : " + message.Embeds[0].Description)
+	}
+	return strings.TrimSpace(text)
+}
+
+// authorName returns the name shown for the author of a replied message
+func authorName(message *discordMessage) string {
+	if message == nil {
+		return ""
+	}
+	if message.Author.Bot && len(message.Embeds) > 0 && message.Embeds[0].Title != "" {
+		return message.Embeds[0].Title // Message relayed from the game, the embed title is the player name
+	}
+	if message.Author.GlobalName != "" {
+		return message.Author.GlobalName
+	}
+	return message.Author.Username
+}
+
+// shorten cuts a text to the maximum length of a relayed message
+func shorten(text string) string {
+	runes := []rune(strings.ReplaceAll(text, "\n", " "))
+	if len(runes) <= maxMessageLength {
+		return string(runes)
+	}
+	return string(runes[:maxMessageLength-3]) + "..."
+}
+
+// authorDisplay returns the name of the author in the guild and the colour of their highest coloured role
+func authorDisplay(botToken string, channelID string, author discordUser) (string, string) {
+	name := author.GlobalName
+	if name == "" {
+		name = author.Username
+	}
+	color := "white"
+
+	guildID := getGuildID(botToken, channelID)
+	if guildID == "" {
+		return name, color
+	}
+	member, exists := getMember(botToken, guildID, author.ID)
+	if !exists {
+		return name, color
+	}
+	if member.Nick != "" {
+		name = member.Nick
+	}
+
+	guild := getRoles(botToken, guildID)
+	position := -1
+	for _, roleID := range member.Roles {
+		role, exists := guild.roles[roleID]
+		if exists && role.Color != 0 && role.Position > position {
+			position = role.Position
+			color = fmt.Sprintf("#%06X", role.Color)
+		}
+	}
+	return name, color
+}
+
+// getGuildID returns the guild of a channel
+func getGuildID(botToken string, channelID string) string {
+	if guildID, exists := channelGuilds[channelID]; exists {
+		return guildID
+	}
+
+	body, err := discord.DefaultClient.Do("GET", "/channels/"+channelID, botToken, nil)
+	if err != nil {
+		fmt.Println("✘ Chat bridge : error while reading channel "+channelID+":", err)
+		return ""
+	}
+	var channel struct {
+		GuildID string `json:"guild_id"`
+	}
+	if err := json.Unmarshal(body, &channel); err != nil {
+		return ""
+	}
+	channelGuilds[channelID] = channel.GuildID
+	return channel.GuildID
+}
+
+// getMember returns a member of a guild, read again after the cache duration
+func getMember(botToken string, guildID string, userID string) (guildMember, bool) {
+	key := guildID + "/" + userID
+	if member, exists := members[key]; exists && time.Since(member.readAt) < cacheDuration {
+		return member, true
+	}
+
+	body, err := discord.DefaultClient.Do("GET", "/guilds/"+guildID+"/members/"+userID, botToken, nil)
+	if err != nil {
+		return guildMember{}, false
+	}
+	var member guildMember
+	if err := json.Unmarshal(body, &member); err != nil {
+		return guildMember{}, false
+	}
+	member.readAt = time.Now()
+	members[key] = member
+	return member, true
+}
+
+// getRoles returns the roles of a guild, read again after the cache duration
+func getRoles(botToken string, guildID string) guildRoles {
+	if guild, exists := roles[guildID]; exists && time.Since(guild.readAt) < cacheDuration {
+		return guild
+	}
+
+	guild := guildRoles{roles: map[string]guildRole{}, readAt: time.Now()}
+	body, err := discord.DefaultClient.Do("GET", "/guilds/"+guildID+"/roles", botToken, nil)
+	if err != nil {
+		fmt.Println("✘ Chat bridge : error while reading roles of guild "+guildID+":", err)
+		return guild
+	}
+	var roleList []guildRole
+	if err := json.Unmarshal(body, &roleList); err != nil {
+		return guild
+	}
+	for _, role := range roleList {
+		guild.roles[role.ID] = role
+	}
+	roles[guildID] = guild
+	return guild
+}
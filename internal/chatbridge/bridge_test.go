@@ -0,0 +1,212 @@
+package chatbridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+// stubDiscord answers the GET requests with the bodies of a map, and counts the requests
+type stubDiscord struct {
+	mutex    sync.Mutex
+	bodies   map[string]string // Path -> body, the other paths answer 404
+	requests int
+}
+
+func (s *stubDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests++
+	body, exists := s.bodies[r.URL.Path]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Unknown"}`))
+		return
+	}
+	w.Write([]byte(body))
+}
+
+func (s *stubDiscord) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+// newStubDiscord points the Discord client to a stub and empties the caches
+func newStubDiscord(t *testing.T, bodies map[string]string) *stubDiscord {
+	stub := &stubDiscord{bodies: bodies}
+	server := httptest.NewServer(stub)
+	previousClient := discord.DefaultClient
+	discord.DefaultClient = discord.NewClient(server.URL)
+	t.Cleanup(func() {
+		server.Close()
+		discord.DefaultClient = previousClient
+		channelGuilds = map[string]string{}
+		members = map[string]guildMember{}
+		roles = map[string]guildRoles{}
+	})
+	return stub
+}
+
+func parseMessage(t *testing.T, content string) discordMessage {
+	t.Helper()
+	var message discordMessage
+	if err := json.Unmarshal([]byte(content), &message); err != nil {
+		t.Fatalf("invalid message %s: %v", content, err)
+	}
+	return message
+}
+
+func TestMessageComponents(t *testing.T) {
+	prefix := services.Text("[Discord] ").WithColor(discordColor)
+	author := services.Text("<Alex>").WithColor("#FF0000").WithHoverText("@alex")
+
+	tests := []struct {
+		name    string
+		message string
+		want    []services.TextComponent
+	}{
+		{
+			name:    "plain message",
+			message: `{"content":"salut","author":{"username":"alex"}}`,
+			want:    []services.TextComponent{prefix, author, services.Text(" salut")},
+		},
+		{
+			name:    "mentions replaced by names",
+			message: `{"content":"<@42> et <@!43> regardez","author":{"username":"alex"},"mentions":[{"id":"42","username":"steve"},{"id":"43","username":"zoe"}]}`,
+			want:    []services.TextComponent{prefix, author, services.Text(" @steve et @zoe regardez")},
+		},
+		{
+			name:    "reply to a member",
+			message: `{"type":19,"content":"oui","author":{"username":"alex"},"referenced_message":{"content":"ça va ?","author":{"username":"bob","global_name":"Bob"}}}`,
+			want: []services.TextComponent{prefix, author,
+				services.Text(" ↪ Bob").WithColor("gray").WithItalic().WithHoverText("ça va ?"),
+				services.Text(" oui"),
+			},
+		},
+		{
+			name:    "reply to a message relayed from the game",
+			message: `{"type":19,"content":"gg","author":{"username":"alex"},"referenced_message":{"author":{"username":"bot","bot":true},"embeds":[{"title":"Steve","description":"j'ai trouvé des diamants"}]}}`,
+			want: []services.TextComponent{prefix, author,
+				services.Text(" ↪ Steve").WithColor("gray").WithItalic().WithHoverText("Steve : j'ai trouvé des diamants"),
+				services.Text(" gg"),
+			},
+		},
+		{
+			name:    "attachments without text",
+			message: `{"author":{"username":"alex"},"attachments":[{"filename":"base.png","url":"https://cdn.example/base.png"},{"filename":"plan.txt","url":"https://cdn.example/plan.txt"}]}`,
+			want: []services.TextComponent{prefix, author,
+				services.Text(" [base.png]").WithColor("aqua").WithUnderline().WithClick(services.ClickOpenURL, "https://cdn.example/base.png").WithHoverText("Ouvrir base.png"),
+				services.Text(" [plan.txt]").WithColor("aqua").WithUnderline().WithClick(services.ClickOpenURL, "https://cdn.example/plan.txt").WithHoverText("Ouvrir plan.txt"),
+			},
+		},
+		{
+			name:    "long message on several lines",
+			message: `{"content":"` + strings.Repeat("a", 200) + `\n` + strings.Repeat("b", 200) + `","author":{"username":"alex"}}`,
+			want:    []services.TextComponent{prefix, author, services.Text(" " + strings.Repeat("a", 200) + " " + strings.Repeat("b", maxMessageLength-204) + "...")},
+		},
+	}
+
+	for _, test := range tests {
+		message := parseMessage(t, test.message)
+		got := messageComponents(message, "Alex", "#FF0000", authorName(message.ReferencedMessage))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got  %+v\n want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestHostileNames checks that names and messages written to break the tellraw command stay plain text
+func TestHostileNames(t *testing.T) {
+	hostile := []string{
+		`"}]`,
+		`\"},{"text":"pwned","clickEvent":{"action":"run_command","value":"/op Steve"}},{"text":"`,
+		`§kAlex§r`,
+		"Alex\n/op Steve",
+	}
+
+	for _, text := range hostile {
+		message := parseMessage(t, `{"author":{"username":"alex"}}`)
+		message.Content = text
+		message.Author.Username = text
+		command, err := services.TellrawCommand("@a", messageComponents(message, text, "white", "")...)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+
+		payload := strings.TrimPrefix(command, "tellraw @a ")
+		var list []json.RawMessage
+		if err := json.Unmarshal([]byte(payload), &list); err != nil {
+			t.Fatalf("%q gave an invalid command %s: %v", text, command, err)
+		}
+		if len(list) != 4 {
+			t.Fatalf("%q gave %d components, want 4: %s", text, len(list), command)
+		}
+		var name services.TextComponent
+		json.Unmarshal(list[2], &name)
+		if name.Text != "<"+text+">" || name.ClickEvent != nil {
+			t.Errorf("%q changed the name component: %s", text, list[2])
+		}
+		if strings.Contains(command, "\n") {
+			t.Errorf("%q left a line break in the command", text)
+		}
+	}
+}
+
+func TestAuthorDisplay(t *testing.T) {
+	newStubDiscord(t, map[string]string{
+		"/channels/10":         `{"guild_id":"1"}`,
+		"/guilds/1/members/20": `{"nick":"Capitaine","roles":["100","101","102"]}`,
+		"/guilds/1/members/22": `{"roles":["102"]}`,
+		"/guilds/1/roles":      `[{"id":"100","color":16711680,"position":1},{"id":"101","color":65280,"position":5},{"id":"102","color":0,"position":9}]`,
+	})
+
+	tests := []struct {
+		name      string
+		author    discordUser
+		wantName  string
+		wantColor string
+	}{
+		{"nickname and highest coloured role", discordUser{ID: "20", Username: "alex", GlobalName: "Alex"}, "Capitaine", "#00FF00"},
+		{"not a member anymore", discordUser{ID: "21", Username: "bob"}, "bob", "white"},
+		{"only uncoloured roles", discordUser{ID: "22", Username: "zoe", GlobalName: "Zoé"}, "Zoé", "white"},
+	}
+	for _, test := range tests {
+		name, color := authorDisplay("token", "10", test.author)
+		if name != test.wantName || color != test.wantColor {
+			t.Errorf("%s: authorDisplay = %q %q, want %q %q", test.name, name, color, test.wantName, test.wantColor)
+		}
+	}
+}
+
+// TestBotMessagesNotRelayed checks that the messages posted by the daemon, its bots and webhooks, are not sent back to the game
+func TestBotMessagesNotRelayed(t *testing.T) {
+	stub := newStubDiscord(t, map[string]string{"/channels/10": `{"guild_id":""}`})
+	channel := &bridgedChannel{id: "10", groups: []string{"main"}}
+
+	ignored := map[string]string{
+		"bot":            `{"content":"Steve a rejoint","author":{"username":"mineotter","bot":true}}`,
+		"webhook":        `{"content":"<Steve> salut","webhook_id":"5","author":{"username":"Steve"}}`,
+		"member joined":  `{"type":7,"author":{"username":"alex"}}`,
+		"pinned message": `{"type":6,"author":{"username":"alex"}}`,
+	}
+	for name, content := range ignored {
+		relayMessage("token", channel, parseMessage(t, content))
+		if count := stub.count(); count != 0 {
+			t.Errorf("%s message was relayed (%d requests)", name, count)
+		}
+	}
+
+	// A member message is relayed, its author is looked up first
+	relayMessage("token", channel, parseMessage(t, `{"content":"salut","author":{"id":"20","username":"alex"}}`))
+	if stub.count() == 0 {
+		t.Error("member message was not relayed")
+	}
+}
@@ -0,0 +1,517 @@
+package commands
+
+// This file contains the slash commands, each command answers with a message built from the database and the servers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/lifecycle"
+	"github.com/Corentin-cott/ServerSentinel/internal/roster"
+	"github.com/Corentin-cott/ServerSentinel/internal/schedule"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+// Option types used by Discord
+const (
+	optionString  = 3
+	optionInteger = 4
+)
+
+// command is a slash command
+type command struct {
+	description string
+	admin       bool // Only the members with an admin role can use the command
+	options     []commandOption
+	run         func(options map[string]string) string
+}
+
+// commandOption is an option of a slash command
+type commandOption struct {
+	name          string
+	description   string
+	kind          int
+	optional      bool
+	choices       []string
+	serverChoices bool // The choices are the servers of the configuration
+}
+
+// commands is the list of the slash commands by name
+var commands = map[string]command{
+	"status": {
+		description: "Affiche l'état des serveurs",
+		run:         statusCommand,
+	},
+	"players": {
+		description: "Affiche les joueurs connectés sur un serveur",
+		options:     []commandOption{{name: "server", description: "Serveur", kind: optionString, serverChoices: true}},
+		run:         playersCommand,
+	},
+	"ping": {
+		description: "Affiche le statut d'un serveur Minecraft vu depuis la liste des serveurs",
+		options:     []commandOption{{name: "server", description: "Serveur", kind: optionString, serverChoices: true}},
+		run:         pingCommand,
+	},
+	"stats": {
+		description: "Affiche les statistiques d'un joueur Minecraft",
+		options:     []commandOption{{name: "player", description: "Pseudo du joueur", kind: optionString}},
+		run:         statsCommand,
+	},
+	"servers": {
+		description: "Affiche la liste des serveurs",
+		run:         serversCommand,
+	},
+	"rcon": {
+		description: "Envoie une commande RCON à un serveur",
+		admin:       true,
+		options: []commandOption{
+			{name: "server", description: "Serveur", kind: optionString, serverChoices: true},
+			{name: "command", description: "Commande à envoyer", kind: optionString},
+		},
+		run: rconCommand,
+	},
+	"server": {
+		description: "Démarre, arrête, redémarre ou tue le conteneur d'un serveur",
+		admin:       true,
+		options: []commandOption{
+			{name: "action", description: "Action", kind: optionString, choices: []string{"start", "stop", "restart", "kill"}},
+			{name: "server", description: "Serveur", kind: optionString, serverChoices: true},
+		},
+		run: serverCommand,
+	},
+	"bridge": {
+		description: "Ajoute ou retire un serveur d'un groupe de chat partagé",
+		admin:       true,
+		options: []commandOption{
+			{name: "action", description: "Action", kind: optionString, choices: []string{"join", "leave", "list"}},
+			{name: "server", description: "Serveur", kind: optionString, serverChoices: true, optional: true},
+			{name: "group", description: "Groupe à rejoindre", kind: optionString, optional: true},
+		},
+		run: bridgeCommand,
+	},
+	"schedule": {
+		description: "Affiche, reporte ou annule les redémarrages programmés",
+		admin:       true,
+		options: []commandOption{
+			{name: "action", description: "Action", kind: optionString, choices: []string{"list", "postpone", "cancel"}},
+			{name: "server", description: "Serveur", kind: optionString, serverChoices: true, optional: true},
+			{name: "minutes", description: "Minutes de report", kind: optionInteger, optional: true},
+		},
+		run: scheduleCommand,
+	},
+	"setprimary": {
+		description: "Change le serveur primaire",
+		admin:       true,
+		options:     []commandOption{{name: "server_id", description: "ID du serveur", kind: optionInteger}},
+		run:         setPrimaryCommand,
+	},
+}
+
+// commandDefinitions returns the commands in the format used by Discord to register them
+func commandDefinitions() []map[string]interface{} {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var definitions []map[string]interface{}
+	for _, name := range names {
+		options := []map[string]interface{}{}
+		for _, option := range commands[name].options {
+			definition := map[string]interface{}{
+				"name":        option.name,
+				"description": option.description,
+				"type":        option.kind,
+				"required":    !option.optional,
+			}
+			choices := option.choices
+			if option.serverChoices {
+				for _, server := range config.AppConfig.Servers {
+					choices = append(choices, server.Name)
+				}
+			}
+			if len(choices) > 0 {
+				var choiceList []map[string]string
+				for _, choice := range choices {
+					choiceList = append(choiceList, map[string]string{"name": choice, "value": choice})
+				}
+				definition["choices"] = choiceList
+			}
+			options = append(options, definition)
+		}
+
+		definitions = append(definitions, map[string]interface{}{
+			"name":        name,
+			"description": commands[name].description,
+			"type":        1, // Slash command
+			"options":     options,
+		})
+	}
+	return definitions
+}
+
+// statusCommand answers with the state of each registered server
+func statusCommand(options map[string]string) string {
+	var lines []string
+	for _, server := range config.AppConfig.Servers {
+		if server.Disabled {
+			continue
+		}
+		serv, err := db.GetServerById(db.ResolveServerID(server))
+		if err != nil {
+			lines = append(lines, "❔ **"+server.Name+"** : serveur introuvable")
+			continue
+		}
+
+		serverRoster := roster.Get(serv.ID)
+		if !serverRoster.Online {
+			line := "🔴 **" + serv.Nom + "** (" + serv.Jeu + ") : hors ligne"
+			if health := db.GetServerRconHealth(server); !health.LastSuccess.IsZero() {
+				line += " (dernière réponse le " + health.LastSuccess.Format("02/01 à 15:04") + ")"
+			}
+			lines = append(lines, line)
+			continue
+		}
+		players := formatPlayers(serverRoster.Players)
+		lines = append(lines, "🟢 **"+serv.Nom+"** ("+serv.Jeu+") : "+players)
+	}
+
+	if len(lines) == 0 {
+		return "Aucun serveur n'est configuré."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// playersCommand answers with the players connected on a server
+func playersCommand(options map[string]string) string {
+	server, exists := config.GetServerConfigByName(options["server"])
+	if !exists {
+		return "Serveur " + options["server"] + " introuvable."
+	}
+	serv, err := db.GetServerById(db.ResolveServerID(server))
+	if err != nil {
+		return "Serveur " + server.Name + " introuvable."
+	}
+
+	serverRoster := roster.Get(serv.ID)
+	if !serverRoster.Online {
+		return "Le serveur **" + serv.Nom + "** est hors ligne."
+	}
+	return "**" + serv.Nom + "** : " + formatPlayers(serverRoster.Players)
+}
+
+// pingCommand answers with the server list ping of a Minecraft server, it works without RCON
+func pingCommand(options map[string]string) string {
+	server, exists := config.GetServerConfigByName(options["server"])
+	if !exists {
+		return "Serveur " + options["server"] + " introuvable."
+	}
+	serv, err := db.GetServerById(db.ResolveServerID(server))
+	if err != nil {
+		return "Serveur " + server.Name + " introuvable."
+	}
+	if serv.Jeu != "Minecraft" {
+		return "Le serveur **" + serv.Nom + "** n'est pas un serveur Minecraft."
+	}
+
+	host, port := db.GetGameAddress(server)
+	status, err := services.PingMinecraftServer(host, port, 5*time.Second)
+	if err != nil {
+		fmt.Println("✘ Error while pinging "+server.Name+":", err)
+		return "Le serveur **" + serv.Nom + "** ne répond pas."
+	}
+
+	lines := []string{
+		"**" + serv.Nom + "** : " + status.Version + fmt.Sprintf(" (protocole %d)", status.Protocol),
+		fmt.Sprintf("Joueurs : %d/%d", status.OnlinePlayers, status.MaxPlayers),
+		fmt.Sprintf("Latence : %dms", status.Latency.Milliseconds()),
+	}
+	if len(status.Sample) > 0 {
+		lines[1] += " (" + strings.Join(status.Sample, ", ") + ")"
+	}
+	if status.MOTD != "" {
+		lines = append(lines, ">>> "+status.MOTD)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatPlayers lists the names of the connected players
+func formatPlayers(players []string) string {
+	if len(players) == 0 {
+		return "aucun joueur connecté"
+	}
+	return fmt.Sprintf("%d joueurs connectés : %s", len(players), strings.Join(players, ", "))
+}
+
+// statsCommand answers with the statistics of a Minecraft player on each server
+func statsCommand(options map[string]string) string {
+	playerName := options["player"]
+	playerUUID, err := services.GetMinecraftPlayerUUID(playerName)
+	if err != nil {
+		return "Le joueur " + playerName + " n'existe pas."
+	}
+	player, err := db.GetPlayerByUUID(playerUUID)
+	if err != nil {
+		return playerName + " ne s'est jamais connecté sur nos serveurs."
+	}
+
+	statistics, err := db.GetMinecraftPlayerGameStatistics(playerUUID)
+	if err != nil {
+		fmt.Println("✘ Error while getting statistics of "+playerName+":", err)
+		return "Impossible de récupérer les statistiques de " + playerName + "."
+	}
+
+	lines := []string{
+		"**Statistiques de " + playerName + "**",
+		"Première connexion : " + player.PremiereCo,
+		"Dernière connexion : " + player.DerniereCo,
+	}
+	today, errToday := db.GetPlayerPlaytimeToday(player.ID)
+	week, errWeek := db.GetPlayerPlaytimeThisWeek(player.ID)
+	if errToday == nil && errWeek == nil {
+		lines = append(lines, "Temps de jeu aujourd'hui : "+formatDuration(today)+", cette semaine : "+formatDuration(week))
+	}
+	for _, stats := range statistics {
+		serverName, err := db.GetServerNameById(stats.ServerID)
+		if err != nil {
+			serverName = "Serveur " + strconv.Itoa(stats.ServerID)
+		}
+		// The play time is in ticks and the distances in centimeters
+		lines = append(lines, fmt.Sprintf("• **%s** : %.1f h de jeu, %d morts, %d kills, %d blocs cassés, %d blocs posés, %.1f km parcourus",
+			serverName, float64(stats.TimePlayed)/20/3600, stats.Deaths, stats.Kills, stats.BlocksDestroyed, stats.BlocksPlaced, float64(stats.TotalDistance)/100000))
+	}
+	if len(statistics) == 0 {
+		lines = append(lines, "Aucune statistique enregistrée.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatDuration formats a play time like "2 h 05 min"
+func formatDuration(duration time.Duration) string {
+	minutes := int(duration.Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%d min", minutes)
+	}
+	return fmt.Sprintf("%d h %02d min", minutes/60, minutes%60)
+}
+
+// serversCommand answers with the servers of the database
+func serversCommand(options map[string]string) string {
+	servers, err := db.GetAllServers()
+	if err != nil {
+		fmt.Println("✘ Error while getting servers:", err)
+		return "Impossible de récupérer la liste des serveurs."
+	}
+
+	primaryID := db.GetPrimaryServerId()
+	secondaryID := db.GetSecondaryServerId()
+	var lines []string
+	for _, serv := range servers {
+		line := fmt.Sprintf("`%d` **%s** (%s %s)", serv.ID, serv.Nom, serv.Jeu, serv.Version)
+		switch serv.ID {
+		case primaryID:
+			line += " — primaire"
+		case secondaryID:
+			line += " — secondaire"
+		}
+		if !serv.Actif {
+			line += " — inactif"
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "Aucun serveur enregistré."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rconCommand sends a command to a server and answers with its response
+func rconCommand(options map[string]string) string {
+	server, exists := config.GetServerConfigByName(options["server"])
+	if !exists {
+		return "Serveur " + options["server"] + " introuvable."
+	}
+
+	host, port, password := db.GetRconAddress(server)
+	response, err := services.SendRconToMinecraftServer(host, port, password, options["command"])
+	if err != nil {
+		fmt.Println("✘ Error while sending RCON command to "+server.Name+":", err)
+		return "Erreur RCON : " + err.Error()
+	}
+	fmt.Println("✔ RCON command sent to " + server.Name + " : " + options["command"])
+
+	if strings.TrimSpace(response) == "" {
+		return "Commande envoyée."
+	}
+	return "```\n" + strings.ReplaceAll(response, "```", "`\u200b``") + "\n```"
+}
+
+// serverActions are the container actions of the server command
+var serverActions = map[string]struct {
+	run  func(serverID int) error
+	done string
+}{
+	"start":   {lifecycle.StartServer, "démarré"},
+	"stop":    {lifecycle.StopServer, "arrêté"},
+	"restart": {lifecycle.RestartServer, "redémarré"},
+	"kill":    {lifecycle.KillServer, "tué"},
+}
+
+// serverCommand starts, stops, restarts or kills the container of a server
+func serverCommand(options map[string]string) string {
+	server, exists := config.GetServerConfigByName(options["server"])
+	if !exists {
+		return "Serveur " + options["server"] + " introuvable."
+	}
+	action, exists := serverActions[options["action"]]
+	if !exists {
+		return "Action " + options["action"] + " inconnue."
+	}
+
+	if err := action.run(db.ResolveServerID(server)); err != nil {
+		fmt.Println("✘ Error while running "+options["action"]+" on "+server.Name+":", err)
+		return "Erreur : " + err.Error()
+	}
+	return "Serveur **" + server.Name + "** " + action.done + "."
+}
+
+// scheduleCommand lists, postpones or cancels the scheduled restarts
+func scheduleCommand(options map[string]string) string {
+	if options["action"] == "list" {
+		restarts, err := schedule.ListPending()
+		if err != nil {
+			fmt.Println("✘ Error while listing the scheduled restarts:", err)
+			return "Erreur : " + err.Error()
+		}
+		if len(restarts) == 0 {
+			return "Aucun redémarrage programmé."
+		}
+		var lines []string
+		for _, restart := range restarts {
+			lines = append(lines, "**"+scheduledServerName(restart.ServerID)+"** : "+formatPendingRestart(restart))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	server, exists := config.GetServerConfigByName(options["server"])
+	if !exists {
+		return "Serveur " + options["server"] + " introuvable."
+	}
+	serverID := db.ResolveServerID(server)
+
+	var restart schedule.PendingRestart
+	var err error
+	switch options["action"] {
+	case "postpone":
+		minutes, convErr := strconv.Atoi(options["minutes"])
+		if convErr != nil || minutes <= 0 {
+			return "Il faut préciser le nombre de minutes de report."
+		}
+		restart, err = schedule.Postpone(serverID, time.Duration(minutes)*time.Minute)
+	case "cancel":
+		restart, err = schedule.Cancel(serverID)
+	default:
+		return "Action " + options["action"] + " inconnue."
+	}
+	if err != nil {
+		fmt.Println("✘ Error while changing the scheduled restart of "+server.Name+":", err)
+		return "Erreur : " + err.Error()
+	}
+	return "Redémarrage de **" + server.Name + "** : " + formatPendingRestart(restart)
+}
+
+// scheduledServerName returns the name of a server with a restart schedule
+func scheduledServerName(serverID int) string {
+	if server, exists := db.GetServerConfigById(serverID); exists {
+		return server.Name
+	}
+	return strconv.Itoa(serverID)
+}
+
+// formatPendingRestart returns the time of a pending restart, with its postponement or cancellation
+func formatPendingRestart(restart schedule.PendingRestart) string {
+	at := "<t:" + strconv.FormatInt(restart.RestartAt.Unix(), 10) + ":f> (<t:" + strconv.FormatInt(restart.RestartAt.Unix(), 10) + ":R>)"
+	switch {
+	case restart.Cancelled:
+		return "~~" + restart.RestartAt.Format("02/01 15:04") + "~~ annulé"
+	case !restart.RestartAt.Equal(restart.Occurrence):
+		return at + ", reporté depuis " + restart.Occurrence.Format("15:04")
+	default:
+		return at
+	}
+}
+
+// setPrimaryCommand changes the primary server
+func setPrimaryCommand(options map[string]string) string {
+	serverID, err := strconv.Atoi(options["server_id"])
+	if err != nil {
+		return "ID de serveur invalide."
+	}
+	serv, err := db.GetServerById(serverID)
+	if err != nil {
+		return "Aucun serveur avec l'ID " + options["server_id"] + "."
+	}
+
+	if err := db.SetPrimaryServerId(serverID); err != nil {
+		fmt.Println("✘ Error while setting primary server:", err)
+		return "Impossible de changer le serveur primaire."
+	}
+	fmt.Println("✔ Primary server set to " + serv.Nom + ".")
+	return "Le serveur primaire est maintenant **" + serv.Nom + "**."
+}
+
+// bridgeCommand adds a server to a bridge group, removes it, or lists the groups
+// The changes are kept until the next restart of the daemon
+func bridgeCommand(options map[string]string) string {
+	serverName := options["server"]
+	switch options["action"] {
+	case "join":
+		if serverName == "" || options["group"] == "" {
+			return "Il faut préciser le serveur et le groupe."
+		}
+		if err := config.SetBridgeGroup(serverName, options["group"]); err != nil {
+			return "Serveur " + serverName + " introuvable."
+		}
+		fmt.Println("✔ Server " + serverName + " joined bridge group " + options["group"] + ".")
+		return "**" + serverName + "** a rejoint le groupe **" + options["group"] + "**."
+	case "leave":
+		if serverName == "" {
+			return "Il faut préciser le serveur."
+		}
+		if err := config.SetBridgeGroup(serverName, ""); err != nil {
+			return "Serveur " + serverName + " introuvable."
+		}
+		fmt.Println("✔ Server " + serverName + " left its bridge group.")
+		return "**" + serverName + "** ne partage plus son chat."
+	}
+
+	groups := map[string][]string{}
+	var names []string
+	for _, server := range config.AppConfig.Servers {
+		group := config.GetBridgeGroup(server)
+		if group == "" {
+			continue
+		}
+		if _, exists := groups[group]; !exists {
+			names = append(names, group)
+		}
+		groups[group] = append(groups[group], server.Name)
+	}
+	if len(names) == 0 {
+		return "Aucun groupe de chat partagé."
+	}
+
+	sort.Strings(names)
+	var lines []string
+	for _, group := range names {
+		lines = append(lines, "**"+group+"** : "+strings.Join(groups[group], ", "))
+	}
+	return strings.Join(lines, "\n")
+}
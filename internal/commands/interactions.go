@@ -0,0 +1,236 @@
+package commands
+
+// This file contains the endpoint receiving the Discord interactions, Discord sends a signed HTTP request for each slash command
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+)
+
+// Interaction and response types used by Discord
+const (
+	interactionPing               = 1
+	interactionApplicationCommand = 2
+	responsePong                  = 1
+	responseMessage               = 4
+	responseDeferredMessage       = 5
+	flagEphemeral                 = 64
+	maxRequestSize                = 1 << 20         // Maximum size of an interaction request
+	discordMessageSize            = 2000            // Maximum length of a Discord message
+	maxTimestampSkew              = 5 * time.Minute // Maximum difference between the timestamp of a request and now, so a captured request can't be replayed later
+)
+
+// interaction is the part of a Discord interaction used by the commands
+type interaction struct {
+	ID            string          `json:"id"`
+	ApplicationID string          `json:"application_id"`
+	Type          int             `json:"type"`
+	Token         string          `json:"token"`
+	Data          interactionData `json:"data"`
+	Member        *struct {
+		Roles []string `json:"roles"`
+		User  struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+	} `json:"member"`
+}
+
+// interactionData is the command used and its options
+type interactionData struct {
+	Name    string `json:"name"`
+	Options []struct {
+		Name  string `json:"name"`
+		Value any    `json:"value"`
+	} `json:"options"`
+}
+
+// Start registers the slash commands and listens for the interactions sent by Discord
+func Start() error {
+	settings := config.AppConfig.Interactions
+	publicKey, err := hex.DecodeString(settings.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("ERROR: INVALID INTERACTIONS PUBLIC KEY")
+	}
+
+	if err := RegisterCommands(); err != nil {
+		return err
+	}
+
+	fmt.Println("✔ Discord interactions endpoint listening on " + settings.ListenAddress + ".")
+	return http.ListenAndServe(settings.ListenAddress, Handler(ed25519.PublicKey(publicKey)))
+}
+
+// RegisterCommands replaces the slash commands of the application with the commands of this package
+func RegisterCommands() error {
+	settings := config.AppConfig.Interactions
+	bot := config.AppConfig.Bots[settings.Bot]
+	if bot.BotToken == "" || settings.ApplicationID == "" {
+		return fmt.Errorf("ERROR: BOT TOKEN OR APPLICATION ID NOT SET FOR INTERACTIONS")
+	}
+
+	path := "/applications/" + settings.ApplicationID + "/commands"
+	if settings.GuildID != "" {
+		path = "/applications/" + settings.ApplicationID + "/guilds/" + settings.GuildID + "/commands"
+	}
+
+	_, err := discord.DefaultClient.Do("PUT", path, bot.BotToken, commandDefinitions())
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE REGISTERING SLASH COMMANDS: %v", err)
+	}
+	fmt.Printf("✔ %d slash commands registered.\n", len(commands))
+	return nil
+}
+
+// Handler returns the HTTP handler of the interactions, the requests not signed with the public key are refused
+func Handler(publicKey ed25519.PublicKey) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if !verifySignature(publicKey, r.Header.Get("X-Signature-Ed25519"), r.Header.Get("X-Signature-Timestamp"), body) {
+			http.Error(w, "invalid request signature", http.StatusUnauthorized)
+			return
+		}
+
+		var request interaction
+		if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		switch request.Type {
+		case interactionPing:
+			writeResponse(w, map[string]interface{}{"type": responsePong})
+		case interactionApplicationCommand:
+			writeResponse(w, handleCommand(request))
+		default:
+			http.Error(w, "unknown interaction type", http.StatusBadRequest)
+		}
+	})
+}
+
+// verifySignature checks the Ed25519 signature of a request and that it was signed a moment ago
+func verifySignature(publicKey ed25519.PublicKey, signature string, timestamp string, body []byte) bool {
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil || len(signatureBytes) != ed25519.SignatureSize {
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > maxTimestampSkew || skew < -maxTimestampSkew {
+		return false
+	}
+	return ed25519.Verify(publicKey, append([]byte(timestamp), body...), signatureBytes)
+}
+
+// handleCommand returns the response to a command
+// Discord waits 3 seconds for a response, so the command runs in the background and its answer replaces the deferred message
+func handleCommand(request interaction) map[string]interface{} {
+	command, exists := commands[request.Data.Name]
+	if !exists {
+		return messageResponse("Commande inconnue.", true)
+	}
+	if command.admin && !isAdmin(request) {
+		fmt.Printf("♟ Slash command /%s refused for user %s : not an admin.\n", request.Data.Name, userName(request))
+		return messageResponse("Vous n'avez pas la permission d'utiliser cette commande.", true)
+	}
+
+	options := map[string]string{}
+	for _, option := range request.Data.Options {
+		options[option.Name] = fmt.Sprint(option.Value)
+	}
+
+	fmt.Printf("♟ Slash command /%s used by %s.\n", request.Data.Name, userName(request))
+	go func() {
+		answer := command.run(options)
+		editResponse(request, answer)
+	}()
+
+	flags := 0
+	if command.admin {
+		flags = flagEphemeral
+	}
+	return map[string]interface{}{
+		"type": responseDeferredMessage,
+		"data": map[string]interface{}{"flags": flags},
+	}
+}
+
+// isAdmin tells if the member who used the command has one of the admin roles
+func isAdmin(request interaction) bool {
+	if request.Member == nil {
+		return false // Commands used outside a guild have no roles
+	}
+	for _, role := range request.Member.Roles {
+		if slices.Contains(config.AppConfig.Interactions.AdminRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// userName returns the name of the member who used the command
+func userName(request interaction) string {
+	if request.Member == nil {
+		return "unknown user"
+	}
+	return request.Member.User.Username
+}
+
+// editResponse replaces the deferred message with the answer of the command
+func editResponse(request interaction, answer string) {
+	path := "/webhooks/" + request.ApplicationID + "/" + request.Token + "/messages/@original"
+	_, err := discord.DefaultClient.Do("PATCH", path, "", discord.MessagePayload(truncateMessage(answer)))
+	if err != nil {
+		fmt.Println("✘ Error while answering slash command /"+request.Data.Name+":", err)
+	}
+}
+
+// messageResponse creates a response with a message
+func messageResponse(content string, ephemeral bool) map[string]interface{} {
+	data := discord.MessagePayload(truncateMessage(content))
+	if ephemeral {
+		data["flags"] = flagEphemeral
+	}
+	return map[string]interface{}{
+		"type": responseMessage,
+		"data": data,
+	}
+}
+
+// truncateMessage cuts a message to the maximum length of a Discord message
+func truncateMessage(content string) string {
+	if len(content) <= discordMessageSize {
+		return content
+	}
+	return strings.ToValidUTF8(content[:discordMessageSize-3], "") + "..."
+}
+
+// writeResponse writes a JSON response
+func writeResponse(w http.ResponseWriter, response map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		fmt.Println("✘ Error while writing interaction response:", err)
+	}
+}
@@ -0,0 +1,252 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+	"github.com/gorcon/rcon"
+)
+
+// signedRequest creates an interaction request signed now, like Discord signs them
+func signedRequest(t *testing.T, privateKey ed25519.PrivateKey, body string) *http.Request {
+	t.Helper()
+	return signedRequestAt(t, privateKey, body, time.Now())
+}
+
+// signedRequestAt creates an interaction request signed at a given time
+func signedRequestAt(t *testing.T, privateKey ed25519.PrivateKey, body string, signedAt time.Time) *http.Request {
+	t.Helper()
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(privateKey, []byte(timestamp+body))))
+	request.Header.Set("X-Signature-Timestamp", timestamp)
+	return request
+}
+
+// serve sends a request to the handler and decodes its JSON response
+func serve(t *testing.T, publicKey ed25519.PublicKey, request *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	Handler(publicKey).ServeHTTP(recorder, request)
+	var response map[string]interface{}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func generateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, privateKey
+}
+
+func TestSignedPing(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	code, response := serve(t, publicKey, signedRequest(t, privateKey, `{"type":1}`))
+	if code != http.StatusOK || response["type"] != float64(responsePong) {
+		t.Errorf("ping answered %d %v", code, response)
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	_, otherKey := generateKey(t)
+
+	requests := map[string]*http.Request{
+		"signed with another key":   signedRequest(t, otherKey, `{"type":1}`),
+		"missing signature":         httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"type":1}`)),
+		"replayed 10 minutes later": signedRequestAt(t, privateKey, `{"type":1}`, time.Now().Add(-10*time.Minute)),
+		"signed 10 minutes ahead":   signedRequestAt(t, privateKey, `{"type":1}`, time.Now().Add(10*time.Minute)),
+	}
+	tampered := signedRequest(t, privateKey, `{"type":1}`)
+	tampered.Header.Set("X-Signature-Timestamp", strconv.FormatInt(time.Now().Unix()-1, 10))
+	requests["changed timestamp"] = tampered
+
+	for name, request := range requests {
+		if code, _ := serve(t, publicKey, request); code != http.StatusUnauthorized {
+			t.Errorf("%s answered %d, want 401", name, code)
+		}
+	}
+}
+
+func TestAdminCommandsRefused(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	config.AppConfig.Interactions.AdminRoles = []string{"100"}
+	t.Cleanup(func() { config.AppConfig.Interactions.AdminRoles = nil })
+
+	bodies := map[string]string{
+		"/rcon without admin role":       `{"type":2,"data":{"name":"rcon","options":[{"name":"command","value":"stop"}]},"member":{"roles":["200"],"user":{"id":"1","username":"player"}}}`,
+		"/setprimary without admin role": `{"type":2,"data":{"name":"setprimary","options":[{"name":"server_id","value":3}]},"member":{"roles":["200"],"user":{"id":"1","username":"player"}}}`,
+		"/rcon outside a guild":          `{"type":2,"data":{"name":"rcon","options":[{"name":"command","value":"stop"}]}}`,
+	}
+	for name, body := range bodies {
+		code, response := serve(t, publicKey, signedRequest(t, privateKey, body))
+		if code != http.StatusOK || response["type"] != float64(responseMessage) {
+			t.Errorf("%s answered %d %v, want a refusal message", name, code, response)
+			continue
+		}
+		data, _ := response["data"].(map[string]interface{})
+		if data["flags"] != float64(flagEphemeral) || !strings.Contains(data["content"].(string), "permission") {
+			t.Errorf("%s answered %v, want an ephemeral refusal", name, data)
+		}
+	}
+}
+
+// stubWebhook records the answers that replace the deferred messages
+type stubWebhook struct {
+	mutex   sync.Mutex
+	answers map[string]string // Path -> content
+}
+
+func (s *stubWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Content string `json:"content"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &payload)
+	s.mutex.Lock()
+	s.answers[r.Method+" "+r.URL.Path] = payload.Content
+	s.mutex.Unlock()
+	w.Write([]byte("{}"))
+}
+
+// waitAnswer waits until the deferred message of the interaction was replaced and returns its content
+func (s *stubWebhook) waitAnswer(t *testing.T) string {
+	t.Helper()
+	key := "PATCH /webhooks/app/token/messages/@original"
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mutex.Lock()
+		answer, exists := s.answers[key]
+		s.mutex.Unlock()
+		if exists {
+			return answer
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("deferred message never replaced, answers = %v", s.answers)
+	return ""
+}
+
+// newStubWebhook points the Discord client to a stub recording the answers
+func newStubWebhook(t *testing.T) *stubWebhook {
+	stub := &stubWebhook{answers: map[string]string{}}
+	server := httptest.NewServer(stub)
+	previousClient := discord.DefaultClient
+	discord.DefaultClient = discord.NewClient(server.URL)
+	t.Cleanup(func() {
+		server.Close()
+		discord.DefaultClient = previousClient
+	})
+	return stub
+}
+
+// serveDeferred sends a command and checks that it's answered with a deferred message
+func serveDeferred(t *testing.T, publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey, body string, wantFlags int) {
+	t.Helper()
+	code, response := serve(t, publicKey, signedRequest(t, privateKey, body))
+	if code != http.StatusOK || response["type"] != float64(responseDeferredMessage) {
+		t.Fatalf("command answered %d %v, want a deferred message", code, response)
+	}
+	data, _ := response["data"].(map[string]interface{})
+	if data["flags"] != float64(wantFlags) {
+		t.Errorf("deferred message flags = %v, want %d", data["flags"], wantFlags)
+	}
+}
+
+// fakeRconServer starts an RCON server answering every command with the same response and returns its port
+func fakeRconServer(t *testing.T, answer string, commands chan<- string) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					request := &rcon.Packet{}
+					if _, err := request.ReadFrom(conn); err != nil {
+						return
+					}
+					if request.Type == rcon.SERVERDATA_AUTH {
+						rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, request.ID, "").WriteTo(conn)
+						rcon.NewPacket(rcon.SERVERDATA_AUTH_RESPONSE, request.ID, "").WriteTo(conn)
+						continue
+					}
+					commands <- request.Body()
+					rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, request.ID, answer).WriteTo(conn)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestAdminRcon(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	stub := newStubWebhook(t)
+	commands := make(chan string, 1)
+	port := fakeRconServer(t, "There are 0 of a max of 20 players online:", commands)
+	config.AppConfig.Interactions.AdminRoles = []string{"100"}
+	config.AppConfig.Servers = []models.ServerConfig{{Name: "survie", RconHost: "127.0.0.1", RconPort: port, RconPassword: "password"}}
+	t.Cleanup(func() {
+		services.CloseRconConnections()
+		config.AppConfig.Interactions.AdminRoles = nil
+		config.AppConfig.Servers = nil
+	})
+
+	body := `{"type":2,"application_id":"app","token":"token","data":{"name":"rcon","options":[{"name":"server","value":"survie"},{"name":"command","value":"list"}]},"member":{"roles":["200","100"],"user":{"id":"1","username":"admin"}}}`
+	serveDeferred(t, publicKey, privateKey, body, flagEphemeral)
+
+	select {
+	case command := <-commands:
+		if command != "list" {
+			t.Errorf("RCON command = %q, want list", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RCON command never received")
+	}
+	if answer := stub.waitAnswer(t); !strings.Contains(answer, "There are 0 of a max of 20 players online:") {
+		t.Errorf("answer = %q, want the RCON response", answer)
+	}
+}
+
+func TestDeferredStatus(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	stub := newStubWebhook(t)
+	config.AppConfig.Servers = []models.ServerConfig{{Name: "ancien", Disabled: true}}
+	t.Cleanup(func() { config.AppConfig.Servers = nil })
+
+	body := `{"type":2,"application_id":"app","token":"token","data":{"name":"status"},"member":{"roles":[],"user":{"id":"1","username":"player"}}}`
+	serveDeferred(t, publicKey, privateKey, body, 0)
+
+	if answer := stub.waitAnswer(t); answer != "Aucun serveur n'est configuré." {
+		t.Errorf("answer = %q, want the status of the servers", answer)
+	}
+}
@@ -0,0 +1,149 @@
+package console
+
+// This file contains the checkpoints of the log files, so the daemon resumes where it stopped after a restart
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+)
+
+// Interval between two saves of the checkpoints file
+const checkpointsSaveInterval = 2 * time.Second
+
+// Checkpoint is the position read in a log file
+type Checkpoint struct {
+	Inode   uint64    `json:"inode"`
+	Offset  int64     `json:"offset"`
+	SavedAt time.Time `json:"savedAt"`
+}
+
+var (
+	checkpoints      = map[string]Checkpoint{}
+	checkpointsMutex sync.Mutex
+	checkpointsDirty bool
+	checkpointsOnce  sync.Once
+)
+
+// LoadCheckpoints loads the checkpoints file and starts saving it periodically
+func LoadCheckpoints() error {
+	checkpointsMutex.Lock()
+	defer checkpointsMutex.Unlock()
+
+	content, err := os.ReadFile(config.AppConfig.CheckpointsFile)
+	if err == nil {
+		if err := json.Unmarshal(content, &checkpoints); err != nil {
+			return fmt.Errorf("ERROR WHILE DECODING CHECKPOINTS FILE %s: %v", config.AppConfig.CheckpointsFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("ERROR WHILE READING CHECKPOINTS FILE %s: %v", config.AppConfig.CheckpointsFile, err)
+	}
+
+	checkpointsOnce.Do(func() {
+		go func() {
+			for range time.Tick(checkpointsSaveInterval) {
+				if err := SaveCheckpoints(); err != nil {
+					fmt.Println("✘ Error while saving checkpoints: " + err.Error())
+				}
+			}
+		}()
+	})
+
+	return nil
+}
+
+// SaveCheckpoints writes the checkpoints file if a checkpoint changed since the last save
+func SaveCheckpoints() error {
+	checkpointsMutex.Lock()
+	defer checkpointsMutex.Unlock()
+
+	if !checkpointsDirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE ENCODING CHECKPOINTS: %v", err)
+	}
+
+	// Write in a temporary file first, so a crash never leaves a half written file
+	tempPath := config.AppConfig.CheckpointsFile + ".tmp"
+	if err := os.WriteFile(tempPath, content, 0644); err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING CHECKPOINTS FILE: %v", err)
+	}
+	if err := os.Rename(tempPath, config.AppConfig.CheckpointsFile); err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING CHECKPOINTS FILE: %v", err)
+	}
+
+	checkpointsDirty = false
+	return nil
+}
+
+// getCheckpoint returns the checkpoint of a log file
+func getCheckpoint(logFilePath string) (Checkpoint, bool) {
+	checkpointsMutex.Lock()
+	defer checkpointsMutex.Unlock()
+
+	checkpoint, exists := checkpoints[logFilePath]
+	return checkpoint, exists
+}
+
+// setCheckpoint records the position read in a log file
+func setCheckpoint(logFilePath string, inode uint64, offset int64) {
+	checkpointsMutex.Lock()
+	defer checkpointsMutex.Unlock()
+
+	checkpoints[logFilePath] = Checkpoint{Inode: inode, Offset: offset, SavedAt: time.Now()}
+	checkpointsDirty = true
+}
+
+// fileInode returns the inode of an opened file, 0 if it can't be read
+func fileInode(file *os.File) uint64 {
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+// Timestamps written by the servers at the start of their log lines
+var (
+	minecraftLineTimeRegex = regexp.MustCompile(`^\[(\d{2}:\d{2}:\d{2})\]`)
+	palworldLineTimeRegex  = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\]`)
+)
+
+// lineTime returns the time written at the start of a log line, or fallback if the line has no timestamp
+func lineTime(line string, fallback time.Time) time.Time {
+	now := time.Now()
+	if matches := palworldLineTimeRegex.FindStringSubmatch(line); matches != nil {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", matches[1], time.Local); err == nil {
+			return t
+		}
+	}
+	// Minecraft only writes the time of day, so it's only trusted if the daemon stopped less than a day ago
+	if matches := minecraftLineTimeRegex.FindStringSubmatch(line); matches != nil && now.Sub(fallback) < 24*time.Hour {
+		if t, err := time.ParseInLocation("15:04:05", matches[1], time.Local); err == nil {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+			if t.After(now) { // The line was written yesterday
+				t = t.AddDate(0, 0, -1)
+			}
+			return t
+		}
+	}
+	return fallback
+}
+
+// isStaleCatchUpLine tells if a line read after a restart, written at the given time, is too old to be notified
+func isStaleCatchUpLine(writtenAt time.Time) bool {
+	maxAge := time.Duration(config.AppConfig.MaxCatchUpMin) * time.Minute
+	return time.Since(writtenAt) > maxAge
+}
@@ -0,0 +1,180 @@
+package console
+
+// This file contains the mirroring of the server consoles to their Discord webhook
+// Lines are grouped over a short window and sent as code blocks, so a burst of lines doesn't send one message per line
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+)
+
+const (
+	mirrorWindow       = 2 * time.Second // Time during which lines are grouped before being sent
+	mirrorMaxMessages  = 3               // Maximum number of messages sent for a window, the other lines are dropped
+	mirrorMaxBuffered  = 1000            // Maximum number of lines kept for a window
+	discordMessageSize = 2000            // Maximum length of a Discord message
+	mirrorNoteSize     = 60              // Room kept in the messages for the dropped lines note
+)
+
+// consoleMirror groups the console lines of a server
+type consoleMirror struct {
+	server  models.ServerConfig
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	mutex   sync.Mutex
+	lines   []string
+	dropped int
+	timer   *time.Timer
+}
+
+var (
+	mirrors      = map[string]*consoleMirror{}
+	mirrorsMutex sync.Mutex
+)
+
+// mirrorLine adds a console line to the next message sent to the server webhook
+func mirrorLine(server models.ServerConfig, line string) {
+	line = cleanLogLine(line)
+	if line == "" {
+		return
+	}
+
+	mirror := getConsoleMirror(server)
+	if !mirror.accepts(line) {
+		return
+	}
+
+	mirror.mutex.Lock()
+	defer mirror.mutex.Unlock()
+
+	if len(mirror.lines) < mirrorMaxBuffered {
+		mirror.lines = append(mirror.lines, line)
+	} else {
+		mirror.dropped++
+	}
+	if mirror.timer == nil {
+		mirror.timer = time.AfterFunc(mirrorWindow, mirror.flush)
+	}
+}
+
+// getConsoleMirror returns the mirror of a server, creating it on the first line
+func getConsoleMirror(server models.ServerConfig) *consoleMirror {
+	mirrorsMutex.Lock()
+	defer mirrorsMutex.Unlock()
+
+	mirror, exists := mirrors[server.Name]
+	if exists {
+		return mirror
+	}
+
+	mirror = &consoleMirror{
+		server:  server,
+		include: compileMirrorFilters(server.Name, server.MirrorInclude),
+		exclude: compileMirrorFilters(server.Name, server.MirrorExclude),
+	}
+	mirrors[server.Name] = mirror
+	return mirror
+}
+
+// compileMirrorFilters compiles the filters of a server, a bad regex is reported and ignored
+func compileMirrorFilters(serverName string, filters []string) []*regexp.Regexp {
+	var regexes []*regexp.Regexp
+	for _, filter := range filters {
+		regex, err := regexp.Compile(filter)
+		if err != nil {
+			fmt.Printf("✘ Console mirror filter %q of server %s ignored: %v\n", filter, serverName, err)
+			continue
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes
+}
+
+// accepts tells if a line passes the include and exclude filters of the server
+func (m *consoleMirror) accepts(line string) bool {
+	for _, regex := range m.exclude {
+		if regex.MatchString(line) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, regex := range m.include {
+		if regex.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends the grouped lines to the server webhook
+func (m *consoleMirror) flush() {
+	m.mutex.Lock()
+	lines := m.lines
+	dropped := m.dropped
+	m.lines = nil
+	m.dropped = 0
+	m.timer = nil
+	m.mutex.Unlock()
+
+	messages, notSent := buildMirrorMessages(lines, mirrorMaxMessages)
+	dropped += notSent
+	if dropped > 0 && len(messages) > 0 {
+		messages[len(messages)-1] += "\n*" + strconv.Itoa(dropped) + " lignes non affichées*"
+		fmt.Printf("♟ Console mirror of %s : %d lines dropped.\n", m.server.Name, dropped)
+	}
+
+	for _, message := range messages {
+		err := outbox.SendWebhook(m.server.Webhook, message)
+		if err != nil {
+			fmt.Println("✘ Error while sending log to Discord webhook: " + err.Error())
+			return
+		}
+	}
+}
+
+// buildMirrorMessages groups lines in code blocks that fit in Discord messages
+// It returns at most maxMessages messages and the number of lines that didn't fit
+func buildMirrorMessages(lines []string, maxMessages int) ([]string, int) {
+	const blockStart, blockEnd = "```\n", "\n```"
+	const size = discordMessageSize - len(blockStart) - len(blockEnd) - mirrorNoteSize
+
+	var messages []string
+	var block strings.Builder
+	for i, line := range lines {
+		// A code block can't be closed from inside
+		line = strings.ReplaceAll(line, "```", "`\u200b``")
+
+		// Each message keeps room for the dropped lines note
+		if len(line) > size {
+			line = strings.ToValidUTF8(line[:size-3], "") + "..."
+		}
+
+		if block.Len() > 0 && block.Len()+1+len(line) > size {
+			messages = append(messages, blockStart+block.String()+blockEnd)
+			block.Reset()
+			if len(messages) == maxMessages {
+				return messages, len(lines) - i
+			}
+		}
+
+		if block.Len() > 0 {
+			block.WriteString("\n")
+		}
+		block.WriteString(line)
+	}
+
+	if block.Len() > 0 {
+		messages = append(messages, blockStart+block.String()+blockEnd)
+	}
+	return messages, 0
+}
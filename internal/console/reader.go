@@ -12,112 +12,250 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Corentin-cott/ServerSentinel/config"
 	"github.com/Corentin-cott/ServerSentinel/internal/db"
 	"github.com/Corentin-cott/ServerSentinel/internal/models"
-	"github.com/Corentin-cott/ServerSentinel/internal/triggers"
+)
+
+// Interval between two scans of the log directory for new log files
+const logFilesScanInterval = 5 * time.Second
+
+var (
+	lastLines      = map[string]time.Time{} // Server name -> time the last line was read
+	lastLinesMutex sync.Mutex
 )
 
 // StartFileLogListener starts listening to a log file in real time
-func StartFileLogListener(logFilePath string, triggersVar []models.Trigger) error {
+// If fromStart is true, the file is read from the beginning, else only the new lines are read
+func StartFileLogListener(logFilePath string, triggersVar []models.Trigger, fromStart bool) error {
+	// Find the server registered for this log file
+	server, exists := config.GetServerConfigByLogFile(logFilePath)
+	if !exists {
+		return fmt.Errorf("NO SERVER REGISTERED FOR LOG FILE %s, CHECK THE SERVERS SECTION OF THE CONFIGURATION", logFilePath)
+	}
+
 	file, err := os.Open(logFilePath)
 	if err != nil {
 		return fmt.Errorf("ERROR WHILE OPENING LOG FILE NAMED %s : %v", logFilePath, err)
 	}
-	defer file.Close()
+	defer func() { file.Close() }() // The file can be reopened, so we close the last one
 
-	// Position the cursor at the end of the file
-	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+	// Position the cursor at the end of the file, or where the daemon stopped reading if the file is the same
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
 		return fmt.Errorf("ERROR WHILE SEEKING TO THE END OF THE FILE NAMED %s : %v", logFilePath, err)
 	}
-
-	fmt.Printf("✔ Started listening to log file %s with %d triggers.\n", logFilePath, len(triggersVar))
+	inode := fileInode(file)
+	catchUpEnd := int64(0) // Lines before this offset were written while the daemon was stopped
+	checkpoint, hasCheckpoint := getCheckpoint(logFilePath)
+	switch {
+	case fromStart:
+		offset = 0
+	case hasCheckpoint && checkpoint.Inode == inode && checkpoint.Offset <= offset:
+		catchUpEnd = offset
+		offset = checkpoint.Offset
+		fmt.Printf("♟ Resuming log file %s at offset %d, %d bytes to catch up.\n", logFilePath, offset, catchUpEnd-offset)
+	case hasCheckpoint:
+		// The file was rotated while the daemon was stopped, the whole new file is caught up
+		catchUpEnd = offset
+		offset = 0
+		fmt.Printf("♟ Log file %s changed while the daemon was stopped, %d bytes to catch up.\n", logFilePath, catchUpEnd)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("ERROR WHILE SEEKING IN THE FILE NAMED %s : %v", logFilePath, err)
+	}
+	setCheckpoint(logFilePath, inode, offset)
 
 	// Read the file line by line
 	reader := bufio.NewReader(file)
+	pending := "" // Part of a line that is still being written
 	for {
-		line, err := reader.ReadString('\n') // Define the delimiter as '\n' is the line break character
+		chunk, err := reader.ReadString('\n') // Define the delimiter as '\n' is the line break character
+		offset += int64(len(chunk))
 		if err != nil {
-			if err.Error() == "EOF" { // If the end of the file is reached, wait for 100ms and continue
-				time.Sleep(100 * time.Millisecond)
-				continue
+			if err != io.EOF {
+				return fmt.Errorf("ERROR WHILE READING LOG FILE NAMED %s : %v", logFilePath, err)
 			}
-			return fmt.Errorf("ERROR WHILE READING LOG FILE NAMED %s : %v", logFilePath, err)
-		}
 
-		// We check if logFilePath ends with 1.log or 2.log. If 1.log, it's primary server. If 2.log, it's secondary server.
-		var serverType string
-		if strings.HasSuffix(logFilePath, "1.log") {
-			serverType = "primary"
-		} else if strings.HasSuffix(logFilePath, "2.log") {
-			serverType = "secondary"
-		} else if strings.HasSuffix(logFilePath, "3.log") {
-			serverType = "partner"
-		} else {
-			fmt.Println("✘ Error while determining server type, is the log file name correct?")
-			return nil
-		}
+			// If the end of the file is reached, wait for 100ms and check that the file is still the same
+			pending += chunk
+			time.Sleep(100 * time.Millisecond)
 
-		// Depending on the server type, we set the serverID
-		var serverID int
-		if serverType == "primary" {
-			serverID = db.GetPrimaryServerId()
-		} else if serverType == "secondary" {
-			serverID = db.GetSecondaryServerId()
-		} else if serverType == "partner" {
-			serverID = db.GetPartenariatServerId()
+			reason := checkLogFileRotation(logFilePath, file, offset)
+			switch reason {
+			case "":
+				continue
+			case "truncated":
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					return fmt.Errorf("ERROR WHILE SEEKING TO THE START OF THE FILE NAMED %s : %v", logFilePath, err)
+				}
+			default:
+				newFile, err := os.Open(logFilePath)
+				if err != nil {
+					continue // The file may be in the middle of its recreation, we try again on the next read
+				}
+				file.Close()
+				file = newFile
+			}
+			fmt.Printf("♟ Log file %s was %s, reading it again from the start.\n", logFilePath, reason)
+			offset = 0
+			catchUpEnd = 0
+			inode = fileInode(file)
+			setCheckpoint(logFilePath, inode, offset)
+			pending = ""
+			reader.Reset(file)
+			continue
 		}
 
-		// We send the log in the appropriate channel by webhook
-		err = triggers.SendToDiscordWebhook(serverType, line)
-		if err != nil {
-			fmt.Println("✘ Error while sending log to Discord webhook: " + err.Error())
-		}
+		line := pending + chunk
+		pending = ""
 
-		// Remove leading and trailing whitespaces
-		line = removeANSIcodes(strings.TrimSpace(line))
-		if line != "" {
-			for _, trigger := range triggersVar {
-				if trigger.Condition(line) {
-					trigger.Action(line, serverID)
-				}
-			}
+		// Old lines read after a restart only update the database at the time written on them, they aren't notified
+		writtenAt := time.Now()
+		if offset <= catchUpEnd {
+			writtenAt = lineTime(cleanLogLine(line), checkpoint.SavedAt)
 		}
+		catchUp := offset <= catchUpEnd && isStaleCatchUpLine(writtenAt)
+		processLogLine(server, line, triggersVar, catchUp, writtenAt)
+		setCheckpoint(logFilePath, inode, offset)
 	}
 }
 
-// Function to process all log files in a directory
-func ProcessLogFiles(logDirPath string, triggersList []models.Trigger) {
-	logFiles, err := filepath.Glob(filepath.Join(logDirPath, "*.log"))
+// checkLogFileRotation checks if the log file was rotated since it was opened
+// It returns "recreated" if the path now points to another file, "truncated" if the file is smaller than what was read, or "" if nothing changed
+func checkLogFileRotation(logFilePath string, file *os.File, offset int64) string {
+	pathInfo, err := os.Stat(logFilePath)
 	if err != nil {
-		log.Fatalf("✘ FATAL ERROR WHEN GETTING LOG FILES: %v", err)
+		return "" // The file was removed, we wait for it to be created again
 	}
 
-	if len(logFiles) == 0 {
-		log.Println("✘ No log files found in the directory, did you forget to redirect the logs to the folder?")
-		return
+	fileInfo, err := file.Stat()
+	if err != nil || !os.SameFile(fileInfo, pathInfo) {
+		return "recreated"
 	}
 
-	// Create a wait group
-	var wg sync.WaitGroup
+	if pathInfo.Size() < offset {
+		return "truncated"
+	}
 
-	// Start a goroutine for each log file
-	for _, logFile := range logFiles {
-		// If logFile is "3.log", ignore it
-		if strings.HasSuffix(logFile, "3.log") { // BAD PRATICE: hardcoded value, but need something quick
-			continue
-		}
-		wg.Add(1)
-		go func(file string) {
-			defer wg.Done()
-			err := StartFileLogListener(file, triggersList)
-			if err != nil {
-				log.Printf("✘ Error with file %s: %v\n", file, err)
+	return ""
+}
+
+// processLogLine mirrors a log line to Discord and runs the triggers on it
+// If catchUp is true, the line is too old to be notified and only the catch up actions are run, with the time the line was written
+func processLogLine(server models.ServerConfig, line string, triggersVar []models.Trigger, catchUp bool, writtenAt time.Time) {
+	if !catchUp {
+		lastLinesMutex.Lock()
+		lastLines[server.Name] = time.Now()
+		lastLinesMutex.Unlock()
+	}
+
+	// We mirror the log in the appropriate channel by webhook
+	if !catchUp && server.Webhook != "" {
+		mirrorLine(server, line)
+	}
+
+	// The server ID is resolved on each line, the primary/secondary servers can change while the daemon runs
+	serverID := db.ResolveServerID(server)
+
+	line = cleanLogLine(line)
+	if line != "" {
+		for _, trigger := range triggersVar {
+			if !trigger.Condition(line) {
+				continue
 			}
-		}(logFile)
+			if !catchUp {
+				trigger.Action(line, serverID)
+			} else if trigger.CatchUpAction != nil {
+				trigger.CatchUpAction(line, serverID, writtenAt)
+			}
+		}
 	}
+}
+
+// GetLastLogLineTime returns the time the last line of a server was read, zero if no line was read since the start
+func GetLastLogLineTime(serverName string) time.Time {
+	lastLinesMutex.Lock()
+	defer lastLinesMutex.Unlock()
+	return lastLines[serverName]
+}
+
+// cleanLogLine removes the leading and trailing whitespaces and the ANSI codes of a line
+func cleanLogLine(line string) string {
+	return removeANSIcodes(strings.TrimSpace(line))
+}
+
+// Function to process the log files of every server registered in the configuration
+// The log directory is scanned periodically, so log files created after startup are picked up
+func ProcessLogFiles(logDirPath string, triggersList []models.Trigger) {
+	var mutex sync.Mutex
+	listening := map[string]bool{} // Log files with a running listener
+	known := map[string]bool{}     // Log files that already existed during a previous scan
+	warned := map[string]bool{}    // Log files we already warned about
 
-	// Wait for all goroutines to finish
-	wg.Wait()
+	for firstScan := true; ; firstScan = false {
+		logFiles, err := filepath.Glob(filepath.Join(logDirPath, "*.log"))
+		if err != nil {
+			log.Fatalf("✘ FATAL ERROR WHEN GETTING LOG FILES: %v", err)
+		}
+
+		// Warn about log files that no server is registered for
+		for _, logFile := range logFiles {
+			if _, exists := config.GetServerConfigByLogFile(logFile); !exists && !warned[logFile] {
+				log.Printf("✘ No server registered for log file %s, it will be ignored.\n", logFile)
+				warned[logFile] = true
+			}
+		}
+
+		// Start a goroutine for each registered server
+		for _, server := range config.AppConfig.Servers {
+			if server.Disabled {
+				if firstScan {
+					fmt.Printf("♟ Server %s is disabled, its log file will be ignored.\n", server.Name)
+				}
+				continue
+			}
+
+			logFile := server.LogFile
+			if !filepath.IsAbs(logFile) {
+				logFile = filepath.Join(logDirPath, logFile)
+			}
+
+			mutex.Lock()
+			alreadyListening := listening[logFile]
+			mutex.Unlock()
+			if alreadyListening {
+				continue
+			}
+
+			if _, err := os.Stat(logFile); err != nil {
+				if !warned[logFile] {
+					log.Printf("✘ Log file %s of server %s not found, waiting for it to be created.\n", logFile, server.Name)
+					warned[logFile] = true
+				}
+				continue
+			}
+
+			// A log file created after startup is read from the start, so its first lines aren't lost
+			fromStart := !firstScan && !known[logFile]
+			known[logFile] = true
+
+			mutex.Lock()
+			listening[logFile] = true
+			mutex.Unlock()
+			go func(file string) {
+				err := StartFileLogListener(file, triggersList, fromStart)
+				if err != nil {
+					log.Printf("✘ Error with file %s: %v\n", file, err)
+				}
+				mutex.Lock()
+				delete(listening, file)
+				mutex.Unlock()
+			}(logFile)
+		}
+
+		time.Sleep(logFilesScanInterval)
+	}
 }
 
 func removeANSIcodes(line string) string {
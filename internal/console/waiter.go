@@ -0,0 +1,118 @@
+package console
+
+// This file contains the waiting for a line in the log file of a server
+// The log file is read on its own, so a line can be waited for outside of the daemon, like in the CLI
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+// DefaultLogDir is the directory of the log files of the servers
+const DefaultLogDir = "/opt/serversentinel/serverslog/"
+
+// Interval between two reads of a log file while waiting for a line
+const waiterPollInterval = 200 * time.Millisecond
+
+// LogWaiter waits for a line in the log file of a server
+type LogWaiter struct {
+	path    string
+	file    *os.File
+	pattern *regexp.Regexp
+}
+
+// LogFilePath returns the path of the log file of a server
+func LogFilePath(server models.ServerConfig) string {
+	if filepath.IsAbs(server.LogFile) {
+		return server.LogFile
+	}
+	return filepath.Join(DefaultLogDir, server.LogFile)
+}
+
+// ExpectLogLine starts watching the log file of a server, only the lines written after this call are matched
+// It must be called before the action writing the line, so the line can't be missed
+func ExpectLogLine(server models.ServerConfig, pattern *regexp.Regexp) (*LogWaiter, error) {
+	path := LogFilePath(server)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR WHILE OPENING LOG FILE OF %s: %v", server.Name, err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ERROR WHILE SEEKING IN LOG FILE OF %s: %v", server.Name, err)
+	}
+	return &LogWaiter{path: path, file: file, pattern: pattern}, nil
+}
+
+// Wait returns the first line matching the pattern, or false if it wasn't written before the timeout
+// A log file truncated or created again, like when a server restarts, is read from its start
+// The waiter can't be used after
+func (w *LogWaiter) Wait(timeout time.Duration) (string, bool) {
+	defer func() { w.file.Close() }()
+
+	deadline := time.Now().Add(timeout)
+	reader := bufio.NewReader(w.file)
+	pending := ""
+	for {
+		chunk, err := reader.ReadString('\n')
+		if err == nil {
+			line := cleanLogLine(pending + chunk)
+			pending = ""
+			if w.pattern.MatchString(line) {
+				return line, true
+			}
+			continue
+		}
+
+		pending += chunk // The end of the line is not written yet
+		if time.Now().After(deadline) {
+			return "", false
+		}
+		time.Sleep(waiterPollInterval)
+		if w.reopenIfReplaced() {
+			reader.Reset(w.file)
+			pending = ""
+		}
+	}
+}
+
+// reopenIfReplaced reads the log file from its start if it was truncated or replaced by a new file
+func (w *LogWaiter) reopenIfReplaced() bool {
+	pathInfo, err := os.Stat(w.path)
+	if err != nil {
+		return false // Not created again yet
+	}
+	fileInfo, err := w.file.Stat()
+	if err != nil {
+		return false
+	}
+
+	if !os.SameFile(pathInfo, fileInfo) {
+		file, err := os.Open(w.path)
+		if err != nil {
+			return false
+		}
+		w.file.Close()
+		w.file = file
+		return true
+	}
+
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err == nil && fileInfo.Size() < offset {
+		_, err = w.file.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return false
+}
+
+// Close stops watching the log file without waiting
+func (w *LogWaiter) Close() {
+	w.file.Close()
+}
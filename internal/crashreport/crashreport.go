@@ -0,0 +1,248 @@
+package crashreport
+
+// This file contains the capture of the crash reports of the Minecraft servers
+// A crashed server writes a crash-reports/crash-*.txt file in its data directory, it is read, saved and posted in the bot admin channel
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/docker"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+)
+
+const (
+	reportWaitTimeout = 30 * time.Second // Time given to a server to write its crash report after its crash line
+	reportMaxAge      = 5 * time.Minute  // A crash report older than this when the crash is read belongs to another crash
+	maxAttachmentSize = 8 << 20          // Larger crash reports are not attached, Discord refuses them
+	maxFieldLength    = 1000             // Length of the description and the exception in the embed
+)
+
+// Report is the content of a crash report
+type Report struct {
+	Path          string
+	Time          time.Time // Modification time of the file
+	Description   string    // Like "Exception in server tick loop"
+	Exception     string    // First line of the stack trace, like "java.lang.NullPointerException: ..."
+	SuspectedMods []string  // Mods named by Forge in the report
+}
+
+// Directory returns the crash reports directory of a server
+// It is in the volume of the container, or in the work directory of a server without container
+func Directory(serv models.Server, server models.ServerConfig) (string, error) {
+	if docker.IsContainerName(serv.Contenaire) {
+		volumePath, err := docker.GetVolumePath(serv.Contenaire, config.AppConfig.Docker.DataDestination)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(volumePath, "crash-reports"), nil
+	}
+	if server.WorkDir != "" {
+		return filepath.Join(server.WorkDir, "crash-reports"), nil
+	}
+	return "", fmt.Errorf("ERROR: SERVER %s HAS NO CONTAINER AND NO WORK DIRECTORY", serv.Nom)
+}
+
+// FindLatest returns the path of the newest crash report of a directory modified after a time, or an empty path
+func FindLatest(directory string, after time.Time) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(directory, "crash-*.txt"))
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	var latestTime time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Before(after) {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest, latestTime = path, info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ReadReport reads a crash report file
+func ReadReport(path string) (Report, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Parse(string(content))
+	report.Path = path
+	report.Time = info.ModTime()
+	return report, nil
+}
+
+// Parse extracts the description, the exception and the suspected mods of a crash report
+// The suspected mods are written by Forge, either on one line or as an indented list
+func Parse(content string) Report {
+	var report Report
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	inMods := false
+	wantException := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if inMods {
+			// The mods are indented with one tab, their details with two
+			if strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "\t\t") && trimmed != "" {
+				report.SuspectedMods = append(report.SuspectedMods, trimmed)
+				continue
+			}
+			if strings.HasPrefix(line, "\t\t") {
+				continue
+			}
+			inMods = false
+		}
+
+		switch {
+		case report.Description == "" && strings.HasPrefix(trimmed, "Description:"):
+			report.Description = strings.TrimSpace(strings.TrimPrefix(trimmed, "Description:"))
+			wantException = true
+		case wantException && trimmed != "":
+			report.Exception = trimmed
+			wantException = false
+		case strings.HasPrefix(trimmed, "Suspected Mod:"), strings.HasPrefix(trimmed, "Suspected Mods:"):
+			value := strings.TrimSpace(trimmed[strings.Index(trimmed, ":")+1:])
+			switch {
+			case value == "":
+				inMods = true
+			case !strings.EqualFold(value, "NONE") && !strings.EqualFold(value, "Unknown"):
+				report.SuspectedMods = append(report.SuspectedMods, value)
+			}
+		}
+	}
+
+	report.SuspectedMods = uniqueSorted(report.SuspectedMods)
+	return report
+}
+
+// Capture waits for the crash report of a crashed server, saves it in the crash history and posts it in the bot admin channel
+func Capture(serverID int) error {
+	serv, err := db.GetServerById(serverID)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE GETTING SERVER %d: %v", serverID, err)
+	}
+	server, _ := db.GetServerConfigById(serverID)
+	directory, err := Directory(serv, server)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE GETTING CRASH REPORTS DIRECTORY OF %s: %v", serv.Nom, err)
+	}
+
+	// The crash line can be written before the report
+	after := time.Now().Add(-reportMaxAge)
+	path := ""
+	for deadline := time.Now().Add(reportWaitTimeout); path == "" && time.Now().Before(deadline); time.Sleep(time.Second) {
+		if path, err = FindLatest(directory, after); err != nil {
+			return fmt.Errorf("ERROR WHILE LOOKING FOR CRASH REPORT OF %s: %v", serv.Nom, err)
+		}
+	}
+	if path == "" {
+		fmt.Printf("♟ No crash report found for %s in %s.\n", serv.Nom, directory)
+		return nil
+	}
+
+	report, err := ReadReport(path)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE READING CRASH REPORT %s: %v", path, err)
+	}
+
+	saved, err := db.SaveServerCrash(models.ServerCrash{
+		ServerID:      serverID,
+		Date:          report.Time.Format("2006-01-02 15:04:05"),
+		File:          filepath.Base(path),
+		Description:   report.Description,
+		Exception:     report.Exception,
+		SuspectedMods: strings.Join(report.SuspectedMods, ", "),
+	})
+	if err != nil {
+		fmt.Println("✘ Error while saving the crash of "+serv.Nom+":", err)
+	} else if !saved {
+		fmt.Printf("♟ Crash report %s of %s was already saved.\n", filepath.Base(path), serv.Nom)
+		return nil // Already posted
+	}
+
+	fmt.Printf("✔ Crash report %s of %s read : %s\n", filepath.Base(path), serv.Nom, report.Description)
+	return postReport(serv, report)
+}
+
+// postReport posts the summary of a crash report with the file attached, or without the file if it can't be sent
+func postReport(serv models.Server, report Report) error {
+	title := "💥 Rapport de crash de " + serv.Nom
+	description := summary(report)
+	channelID := config.AppConfig.DiscordChannels.BotAdminChannelID
+	color := "#ff0000"
+
+	content, err := os.ReadFile(report.Path)
+	if err == nil && len(content) <= maxAttachmentSize {
+		file := discord.File{Name: filepath.Base(report.Path), Content: content}
+		err = discord.SendDiscordEmbedWithFile(config.AppConfig.Bots["mineotterBot"], channelID, title, description, color, file)
+		if err == nil {
+			return nil
+		}
+		fmt.Println("✘ Error while sending the crash report of "+serv.Nom+", it is sent without its file:", err)
+	}
+
+	description += "\n*Fichier non joint, il est dans " + report.Path + "*"
+	return outbox.SendDiscordEmbed("mineotterBot", channelID, title, description, color)
+}
+
+// summary returns the description of the crash report embed
+func summary(report Report) string {
+	description := report.Description
+	if description == "" {
+		description = "inconnue"
+	}
+	lines := []string{"**Description :** " + truncate(description)}
+	if report.Exception != "" {
+		lines = append(lines, "**Exception :** `"+truncate(strings.ReplaceAll(report.Exception, "`", "'"))+"`")
+	}
+	if len(report.SuspectedMods) > 0 {
+		lines = append(lines, "**Mods suspects :** "+truncate(strings.Join(report.SuspectedMods, ", ")))
+	}
+	lines = append(lines, "**Fichier :** "+filepath.Base(report.Path))
+	return strings.Join(lines, "\n")
+}
+
+// truncate shortens a text to the length of an embed field
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxFieldLength {
+		return text
+	}
+	return string(runes[:maxFieldLength-1]) + "…"
+}
+
+// uniqueSorted removes the duplicates of a list and sorts it
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
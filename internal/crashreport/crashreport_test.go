@@ -0,0 +1,82 @@
+package crashreport
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+const forgeReport = `---- Minecraft Crash Report ----
+// Don't be sad, have a hug! <3
+
+Time: 2025-01-12 18:03:44
+Description: Exception in server tick loop
+
+java.lang.NullPointerException: Cannot invoke "net.minecraft.world.entity.Entity.getId()" because "entity" is null
+	at com.simibubi.create.content.Foo.tick(Foo.java:42) ~[create-1.20.1-0.5.1.f.jar%23187!/:0.5.1.f] {re:classloading}
+
+A detailed walkthrough of the error, its code path and all known details is as follows:
+---------------------------------------------------------------------------------------
+
+-- Head --
+Thread: Server thread
+Suspected Mods: 
+	Create (create), Version: 0.5.1.f
+		Issue tracker URL: https://github.com/Creators-of-Create/Create/issues
+	Flywheel (flywheel), Version: 0.6.10
+Stacktrace:
+	at com.simibubi.create.content.Foo.tick(Foo.java:42)
+
+-- Block entity being ticked --
+Suspected Mod: Create (create), Version: 0.5.1.f
+`
+
+func TestParse(t *testing.T) {
+	report := Parse(forgeReport)
+	if report.Description != "Exception in server tick loop" {
+		t.Errorf("Description = %q", report.Description)
+	}
+	if report.Exception != `java.lang.NullPointerException: Cannot invoke "net.minecraft.world.entity.Entity.getId()" because "entity" is null` {
+		t.Errorf("Exception = %q", report.Exception)
+	}
+	want := []string{"Create (create), Version: 0.5.1.f", "Flywheel (flywheel), Version: 0.6.10"}
+	if !slices.Equal(report.SuspectedMods, want) {
+		t.Errorf("SuspectedMods = %q", report.SuspectedMods)
+	}
+}
+
+func TestParseVanilla(t *testing.T) {
+	report := Parse("---- Minecraft Crash Report ----\nDescription: Watching Server\n\njava.lang.Error: Watchdog\n\tat x\n\nSuspected Mods: NONE\n")
+	if report.Description != "Watching Server" || report.Exception != "java.lang.Error: Watchdog" || len(report.SuspectedMods) != 0 {
+		t.Errorf("Parse() = %+v", report)
+	}
+}
+
+func TestFindLatest(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Time{
+		"crash-2025-01-10_12.00.00-server.txt": now.Add(-time.Hour),
+		"crash-2025-01-12_18.03.44-server.txt": now.Add(-time.Minute),
+		"crash-2025-01-12_18.03.44-fml.log":    now,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("---- Minecraft Crash Report ----"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err := FindLatest(dir, now.Add(-5*time.Minute))
+	if err != nil || filepath.Base(path) != "crash-2025-01-12_18.03.44-server.txt" {
+		t.Errorf("FindLatest() = %q, %v", path, err)
+	}
+	if path, err := FindLatest(dir, now.Add(time.Minute)); err != nil || path != "" {
+		t.Errorf("FindLatest() without recent report = %q, %v", path, err)
+	}
+}
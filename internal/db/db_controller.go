@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Corentin-cott/ServerSentinel/config"
@@ -38,6 +39,14 @@ func ConnectToDatabase() error {
 		return fmt.Errorf("ERROR WHILE PINGING DATABASE WITH CONNECTION STRING: (%v) ! ERROR: %v", dsn, err)
 	}
 
+	// The sessions and crashes tables were added after the others, so they're created if needed
+	if err := createSessionsTable(); err != nil {
+		return err
+	}
+	if err := createCrashesTable(); err != nil {
+		return err
+	}
+
 	fmt.Println("✔ Successfully connected to the database.")
 	return nil
 }
@@ -56,7 +65,7 @@ func GetAllServers() ([]models.Server, error) {
 	var servers []models.Server
 	for rows.Next() {
 		var serv models.Server
-		if err := rows.Scan(&serv.ID, &serv.Nom, &serv.Jeu, &serv.Version, &serv.Modpack, &serv.ModpackURL, &serv.NomMonde, &serv.EmbedColor, &serv.Contenaire, &serv.Description, &serv.Actif, &serv.Global); err != nil {
+		if err := rows.Scan(&serv.ID, &serv.Nom, &serv.Jeu, &serv.Version, &serv.Modpack, &serv.ModpackURL, &serv.NomMonde, &serv.EmbedColor, &serv.Contenaire, &serv.Description, &serv.Actif, &serv.Global, &serv.Type, &serv.Image); err != nil {
 			return nil, fmt.Errorf("FAILED TO SCAN SERVER: %v", err)
 		}
 		servers = append(servers, serv)
@@ -77,7 +86,7 @@ func GetAllMinecraftServers() ([]models.Server, error) {
 	var servers []models.Server
 	for rows.Next() {
 		var serv models.Server
-		if err := rows.Scan(&serv.ID, &serv.Nom, &serv.Jeu, &serv.Version, &serv.Modpack, &serv.ModpackURL, &serv.NomMonde, &serv.EmbedColor, &serv.Contenaire, &serv.Description, &serv.Actif, &serv.Global); err != nil {
+		if err := rows.Scan(&serv.ID, &serv.Nom, &serv.Jeu, &serv.Version, &serv.Modpack, &serv.ModpackURL, &serv.NomMonde, &serv.EmbedColor, &serv.Contenaire, &serv.Description, &serv.Actif, &serv.Global, &serv.Type, &serv.Image); err != nil {
 			return nil, fmt.Errorf("FAILED TO SCAN MINECRAFT SERVER: %v", err)
 		}
 		servers = append(servers, serv)
@@ -247,6 +256,7 @@ func SetPrimaryServerId(serverID int) error {
 	if err != nil {
 		return fmt.Errorf("FAILED TO SET PRIMARY SERVER: %v", err)
 	}
+	forgetResolvedServers()
 
 	return nil
 }
@@ -258,6 +268,7 @@ func SetSecondaryServerId(serverID int) error {
 	if err != nil {
 		return fmt.Errorf("FAILED TO SET SECONDARY SERVER: %v", err)
 	}
+	forgetResolvedServers()
 
 	return nil
 }
@@ -269,6 +280,7 @@ func SetPartenariatServerId(serverID int) error {
 	if err != nil {
 		return fmt.Errorf("FAILED TO SET PARTENARIAT SERVER: %v", err)
 	}
+	forgetResolvedServers()
 
 	return nil
 }
@@ -353,45 +365,170 @@ func GetServerColorByName(serverName string) (string, error) {
 	return serverColor, nil
 }
 
-// GetRconParameters retrieves the RCON parameters based on the server
-func GetRconParameters(servertype string) (models.Server, string, string, string, error) {
-	var (
-		err                  error
-		serverToSend         models.Server
-		serverToSendHost     string
-		serverToSendRconPort int
-	)
-	if servertype == "primary" {
-		// If the server is primary, we send the message to the secondary server
-		otherServerID := GetSecondaryServerId()
-		serverToSend, err = GetServerById(otherServerID)
+// ResolveServerID returns the ID of the server registered in the configuration, -1 if it can't be resolved
+func ResolveServerID(server models.ServerConfig) int {
+	if server.ServerID > 0 {
+		return server.ServerID
+	}
+
+	if server.ServerName != "" {
+		serv, err := GetServerByName(server.ServerName)
 		if err != nil {
-			return models.Server{}, "", "", "", fmt.Errorf("ERROR WHILE GETTING SECONDARY SERVER : %v", err)
+			fmt.Println("FAILED TO RESOLVE SERVER "+server.Name+":", err)
+			return -1
 		}
-		serverToSendHost = GetPrimaryServerHost()
-		serverToSendRconPort = GetSecondaryServerRconPort()
-	} else if servertype == "secondary" {
-		// If the server is secondary, we send the message to the primary server
-		otherServerID := GetPrimaryServerId()
-		serverToSend, err = GetServerById(otherServerID)
-		if err != nil {
-			return models.Server{}, "", "", "", fmt.Errorf("ERROR WHILE GETTING PRIMARY SERVER : %v", err)
+		return serv.ID
+	}
+
+	switch server.Role {
+	case "primary":
+		return GetPrimaryServerId()
+	case "secondary":
+		return GetSecondaryServerId()
+	case "partner":
+		return GetPartenariatServerId()
+	}
+
+	fmt.Println("FAILED TO RESOLVE SERVER " + server.Name + ": NO SERVER ID, SERVER NAME OR ROLE SET")
+	return -1
+}
+
+// Resolving a registered server set by name or role runs a query, so the resolved IDs are kept for a while
+// They are read again sooner when a role changes, the roles can also be changed by the CLI in another process
+const resolvedServersDuration = time.Minute
+
+var (
+	resolvedServersMutex  sync.Mutex
+	resolvedServers       map[int]models.ServerConfig // Server ID -> registered server
+	resolvedServersReadAt time.Time
+)
+
+// GetServerConfigById returns the registered server that resolves to the given server ID
+func GetServerConfigById(serverID int) (models.ServerConfig, bool) {
+	resolvedServersMutex.Lock()
+	defer resolvedServersMutex.Unlock()
+
+	if resolvedServers == nil || time.Since(resolvedServersReadAt) > resolvedServersDuration {
+		resolvedServers = map[int]models.ServerConfig{}
+		for _, server := range config.AppConfig.Servers {
+			id := ResolveServerID(server)
+			if _, exists := resolvedServers[id]; id != -1 && !exists {
+				resolvedServers[id] = server
+			}
 		}
-		serverToSendHost = GetPrimaryServerHost()
-		serverToSendRconPort = GetPrimaryServerRconPort()
-	} else {
-		// Not a valid server type or partnership server
-		return models.Server{}, "", "", "", fmt.Errorf("INVALID SERVER TYPE OR PARTNERSHIP SERVER: %s", servertype)
+		resolvedServersReadAt = time.Now()
 	}
 
-	// We get the RCON password for the server
-	serverToSendRconPassword := GetRconPassword()
-	if err != nil {
-		return models.Server{}, "", "", "", fmt.Errorf("FAILED TO GET RCON PASSWORD: %v", err)
+	server, exists := resolvedServers[serverID]
+	return server, exists
+}
+
+// forgetResolvedServers makes the next GetServerConfigById resolve the registered servers again, after a role changed
+func forgetResolvedServers() {
+	resolvedServersMutex.Lock()
+	resolvedServers = nil
+	resolvedServersMutex.Unlock()
+}
+
+// GetRconAddress returns the RCON host, port and password of a registered server
+// Values missing from the configuration are read from serveurs_parameters depending on the server role
+func GetRconAddress(server models.ServerConfig) (string, string, string) {
+	host := server.RconHost
+	port := server.RconPort
+	password := server.RconPassword
+
+	if host == "" {
+		switch server.Role {
+		case "secondary":
+			host = GetSecondaryServerHost()
+		case "partner":
+			host = GetPartenariatServerHost()
+		default:
+			host = GetPrimaryServerHost()
+		}
+	}
+
+	if port == 0 {
+		switch server.Role {
+		case "primary":
+			port = GetPrimaryServerRconPort()
+		case "secondary":
+			port = GetSecondaryServerRconPort()
+		case "partner":
+			port = GetPartenariatServerRconPort()
+		}
+	}
+
+	if password == "" {
+		if server.Role == "partner" {
+			password = GetPartenariatServerRconPassword()
+		} else {
+			password = GetRconPassword()
+		}
+	}
+
+	return host, strconv.Itoa(port), password
+}
+
+// GetGameAddress returns the host and port of the server list ping of a registered Minecraft server
+func GetGameAddress(server models.ServerConfig) (string, string) {
+	host := server.GameHost
+	if host == "" {
+		host, _, _ = GetRconAddress(server)
+	}
+	port := server.GamePort
+	if port == 0 {
+		port = 25565
+	}
+	return host, strconv.Itoa(port)
+}
+
+// GetPalworldClient returns the client of a registered Palworld server
+func GetPalworldClient(server models.ServerConfig) *services.PalworldClient {
+	host, port, password := GetRconAddress(server)
+	restPassword := server.RestPassword
+	if restPassword == "" {
+		restPassword = password // Palworld uses its admin password for both
 	}
+	return services.NewPalworldClient(server.RestURL, restPassword, host, port, password)
+}
 
-	fmt.Println("RCON parameters retrieved successfully for server:", serverToSend.Nom)
-	return serverToSend, serverToSendHost, strconv.Itoa(serverToSendRconPort), serverToSendRconPassword, nil
+// GetServerRconHealth returns the state of the RCON connection of a registered server
+func GetServerRconHealth(server models.ServerConfig) services.RconHealth {
+	host, port, _ := GetRconAddress(server)
+	return services.GetRconHealth(host, port)
+}
+
+// GetBridgeTargets returns the other servers of the bridge group of the given server, with their RCON parameters
+// A member that can't be resolved is reported and skipped, so it doesn't stop the relay to the others
+func GetBridgeTargets(source models.ServerConfig) ([]models.BridgeTarget, error) {
+	group := config.GetBridgeGroup(source)
+	if group == "" {
+		return nil, fmt.Errorf("SERVER %s IS NOT IN A BRIDGE GROUP", source.Name)
+	}
+
+	var targets []models.BridgeTarget
+	for _, member := range config.GetBridgeMembers(group) {
+		if member.Name == source.Name {
+			continue
+		}
+
+		serverToSend, err := GetServerById(ResolveServerID(member))
+		if err != nil {
+			fmt.Println("ERROR WHILE GETTING SERVER "+member.Name+" OF BRIDGE GROUP "+group+":", err)
+			continue
+		}
+
+		host, port, password := GetRconAddress(member)
+		if password == "" {
+			fmt.Println("FAILED TO GET RCON PASSWORD FOR SERVER " + member.Name)
+			continue
+		}
+
+		targets = append(targets, models.BridgeTarget{Config: member, Server: serverToSend, RconHost: host, RconPort: port, RconPassword: password})
+	}
+
+	return targets, nil
 }
 
 /* -----------------------------------------------------
@@ -403,10 +540,10 @@ Table joueurs_connections_log {
 }
 ----------------------------------------------------- */
 
-// SaveConnectionLog saves a connection log for a player
-func SaveConnectionLog(playerID int, serverID int) error {
+// SaveConnectionLog saves a connection log for a player at the time they joined
+func SaveConnectionLog(playerID int, serverID int, date time.Time) error {
 	query := "INSERT INTO joueurs_connections_log (serveur_id, joueur_id, date) VALUES (?, ?, ?)"
-	_, err := db.Exec(query, serverID, playerID, GetGoodDatetime())
+	_, err := db.Exec(query, serverID, playerID, date)
 	if err != nil {
 		return fmt.Errorf("FAILED TO SAVE CONNECTION LOG: %v", err)
 	}
@@ -466,7 +603,12 @@ func GetAllMinecraftPlayers() ([]models.Player, error) {
 
 // CheckAndInsertPlayer checks if a player exists in the database and inserts it if it doesn't
 func CheckAndInsertPlayerWithPlayerName(playerName string, serverID int, timeConf string) (int, error) {
-	getPlayerUUID, err := GetPlayerAccountIdByPlayerName(playerName, "Minecraft")
+	jeu, err := GetServerGameById(serverID)
+	if err != nil {
+		return -1, fmt.Errorf("FAILED TO GET SERVER GAME: %v", err)
+	}
+
+	getPlayerUUID, err := GetPlayerAccountIdByPlayerName(playerName, jeu)
 	if err != nil {
 		return -1, fmt.Errorf("FAILED TO GET PLAYER UUID BY PLAYER NAME: %v", err)
 	}
@@ -534,15 +676,15 @@ func CheckAndInsertPlayerWithPlayerUUID(playerUUID string, serverID int, timeCon
 	return playerID, nil
 }
 
-// UpdatePlayerLastConnection updates the last connection date of a player
-func UpdatePlayerLastConnection(playerID int) error {
+// UpdatePlayerLastConnection updates the last connection date of a player, a caught up connection older than the saved one doesn't change it
+func UpdatePlayerLastConnection(playerID int, date time.Time) error {
 	if playerID == -1 {
 		return fmt.Errorf("PLAYER ID IS -1, CANNOT UPDATE LAST CONNECTION")
 	}
 
 	fmt.Println("Updating last connection for player ID", playerID)
-	updateQuery := "UPDATE joueurs SET derniere_co = NOW() WHERE id = ?"
-	_, err := db.Exec(updateQuery, playerID)
+	updateQuery := "UPDATE joueurs SET derniere_co = GREATEST(COALESCE(derniere_co, ?), ?) WHERE id = ?"
+	_, err := db.Exec(updateQuery, date, date, playerID)
 	if err != nil {
 		return fmt.Errorf("FAILED TO UPDATE LAST CONNECTION: %v", err)
 	}
@@ -619,6 +761,20 @@ func GetPlayerIdByAccountId(accountId any) (int, error) {
 	return playerID, nil
 }
 
+// FindPlayerIdByAccountId returns the ID of a player by their account ID, or -1 if they aren't in the database
+func FindPlayerIdByAccountId(accountId any) (int, error) {
+	query := "SELECT id FROM joueurs WHERE compte_id = ?"
+	var playerID int
+	err := db.QueryRow(query, accountId).Scan(&playerID)
+	if err == sql.ErrNoRows {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("FAILED TO GET PLAYER ID: %v", err)
+	}
+	return playerID, nil
+}
+
 // Getter to get the player account ID by the player name
 func GetPlayerAccountIdByPlayerName(playerName string, jeu string) (string, error) {
 	if jeu == "" {
@@ -628,6 +784,18 @@ func GetPlayerAccountIdByPlayerName(playerName string, jeu string) (string, erro
 	switch jeu {
 	case "Minecraft":
 		return services.GetMinecraftPlayerUUID(playerName)
+	case "Palworld":
+		// Palworld has no public API, the player must be connected to one of the registered servers
+		for _, server := range config.AppConfig.Servers {
+			serverGame, err := GetServerGameById(ResolveServerID(server))
+			if err != nil || serverGame != "Palworld" {
+				continue
+			}
+			if userID, err := GetPalworldClient(server).GetPlayerUserID(playerName); err == nil {
+				return userID, nil
+			}
+		}
+		return "", fmt.Errorf("PALWORLD PLAYER %s NOT FOUND ON THE REGISTERED SERVERS", playerName)
 	default:
 		return "", fmt.Errorf("UNKNOWN GAME: %s", jeu)
 	}
@@ -670,6 +838,30 @@ func CheckMinecraftPlayerGameStatisticsExists(playerUUID string, serverID int) b
 	return count > 0
 }
 
+// GetMinecraftPlayerGameStatistics returns the game statistics of a Minecraft player on every server
+func GetMinecraftPlayerGameStatistics(playerUUID string) ([]models.MinecraftPlayerGameStatistics, error) {
+	query := `
+		SELECT serveur_id, tmps_jeux, nb_mort, nb_kills, nb_playerkill, nb_blocs_detr, nb_blocs_pose, dist_total, dern_enregistrment
+		FROM joueurs_stats
+		WHERE compte_id = ?`
+	rows, err := db.Query(query, playerUUID)
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO GET PLAYER STATISTICS: %v", err)
+	}
+	defer rows.Close()
+
+	var statistics []models.MinecraftPlayerGameStatistics
+	for rows.Next() {
+		var stats models.MinecraftPlayerGameStatistics
+		if err := rows.Scan(&stats.ServerID, &stats.TimePlayed, &stats.Deaths, &stats.Kills, &stats.PlayerKills, &stats.BlocksDestroyed, &stats.BlocksPlaced, &stats.TotalDistance, &stats.LastRecordedTime); err != nil {
+			return nil, fmt.Errorf("FAILED TO SCAN PLAYER STATISTICS: %v", err)
+		}
+		statistics = append(statistics, stats)
+	}
+
+	return statistics, nil
+}
+
 // SaveMinecraftPlayerGameStatistics saves the game statistics of a Minecraft player
 func SaveMinecraftPlayerGameStatistics(serverID int, playerUUID string, playerStats models.MinecraftPlayerGameStatistics) error {
 	// Prepare the SQL query
@@ -819,7 +1011,22 @@ func AddBadgeToPlayer(joueurID int, badgeID int) error {
 
 /* Misc */
 
+// ExecRuleQuery executes a query declared in the triggers rules file
+func ExecRuleQuery(query string, args ...any) error {
+	_, err := db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("FAILED TO EXECUTE RULE QUERY: %v", err)
+	}
+
+	return nil
+}
+
 func GetGoodDatetime() time.Time {
 	// Time of now + 1 hour. Not good practice, but it's a quick fix. Again. Yeah.
-	return time.Now().Add(time.Hour)
+	return ToGoodDatetime(time.Now())
+}
+
+// ToGoodDatetime shifts a time like GetGoodDatetime, for the times that aren't now, like the time written on a log line
+func ToGoodDatetime(t time.Time) time.Time {
+	return t.Add(time.Hour)
 }
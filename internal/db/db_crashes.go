@@ -0,0 +1,78 @@
+package db
+
+// This file contains the crash history of the servers, a crash is saved when the crash report of a server is read
+
+import (
+	"fmt"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+/* -----------------------------------------------------
+Table serveurs_crashs {
+  id INT [pk, increment]
+  serveur_id INT [ref: > serveurs.id, not null]
+  date DATETIME [not null]
+  fichier VARCHAR(255) [not null] // Name of the crash report file
+  description TEXT [null]
+  exception TEXT [null]
+  mods_suspects TEXT [null] // Separated by commas
+}
+----------------------------------------------------- */
+
+// createCrashesTable creates the crashes table if it doesn't exist yet
+func createCrashesTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS serveurs_crashs (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			serveur_id INT NOT NULL,
+			date DATETIME NOT NULL,
+			fichier VARCHAR(255) NOT NULL,
+			description TEXT NULL,
+			exception TEXT NULL,
+			mods_suspects TEXT NULL,
+			UNIQUE INDEX idx_serveurs_crashs_fichier (serveur_id, fichier),
+			INDEX idx_serveurs_crashs_date (serveur_id, date)
+		)`
+	_, err := db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("FAILED TO CREATE CRASHES TABLE: %v", err)
+	}
+	return nil
+}
+
+// SaveServerCrash saves a crash of a server, a crash report already saved is ignored
+// It returns false if the crash report was already saved
+func SaveServerCrash(crash models.ServerCrash) (bool, error) {
+	query := "INSERT IGNORE INTO serveurs_crashs (serveur_id, date, fichier, description, exception, mods_suspects) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, crash.ServerID, crash.Date, crash.File, crash.Description, crash.Exception, crash.SuspectedMods)
+	if err != nil {
+		return false, fmt.Errorf("FAILED TO SAVE SERVER CRASH: %v", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("FAILED TO SAVE SERVER CRASH: %v", err)
+	}
+	return inserted > 0, nil
+}
+
+// GetServerCrashes returns the last crashes of a server, the newest first
+func GetServerCrashes(serverID int, limit int) ([]models.ServerCrash, error) {
+	query := "SELECT id, serveur_id, date, fichier, COALESCE(description, ''), COALESCE(exception, ''), COALESCE(mods_suspects, '') FROM serveurs_crashs WHERE serveur_id = ? ORDER BY date DESC LIMIT ?"
+	rows, err := db.Query(query, serverID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO GET SERVER CRASHES: %v", err)
+	}
+	defer rows.Close()
+
+	var crashes []models.ServerCrash
+	for rows.Next() {
+		var crash models.ServerCrash
+		if err := rows.Scan(&crash.ID, &crash.ServerID, &crash.Date, &crash.File, &crash.Description, &crash.Exception, &crash.SuspectedMods); err != nil {
+			return nil, fmt.Errorf("FAILED TO SCAN SERVER CRASH: %v", err)
+		}
+		crashes = append(crashes, crash)
+	}
+
+	return crashes, nil
+}
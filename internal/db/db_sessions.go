@@ -0,0 +1,237 @@
+package db
+
+// This file contains the player sessions, a session is opened when a player joins a server and closed when they leave
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+/* -----------------------------------------------------
+Table joueurs_sessions {
+  id INT [pk, increment]
+  serveur_id INT [ref: > serveurs.id, not null]
+  joueur_id INT [ref: > joueurs.id, not null]
+  pseudo VARCHAR(255) [null] // Name of the player when they joined, the leave lines only hold it
+  debut DATETIME [not null]
+  fin DATETIME [null]
+  duree INT [null] // In seconds, set when the session is closed
+}
+----------------------------------------------------- */
+
+// createSessionsTable creates the sessions table if it doesn't exist yet
+func createSessionsTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS joueurs_sessions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			serveur_id INT NOT NULL,
+			joueur_id INT NOT NULL,
+			pseudo VARCHAR(255) NULL,
+			debut DATETIME NOT NULL,
+			fin DATETIME NULL,
+			duree INT NULL,
+			INDEX idx_joueurs_sessions_joueur (joueur_id, debut),
+			INDEX idx_joueurs_sessions_ouvertes (serveur_id, fin)
+		)`
+	_, err := db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("FAILED TO CREATE SESSIONS TABLE: %v", err)
+	}
+	return nil
+}
+
+// OpenPlayerSession opens a session for a player on a server at the time they joined, nothing is done if a session is already open
+func OpenPlayerSession(playerID int, serverID int, playerName string, joinedAt time.Time) error {
+	query := "SELECT COUNT(*) FROM joueurs_sessions WHERE joueur_id = ? AND serveur_id = ? AND fin IS NULL"
+	var count int
+	if err := db.QueryRow(query, playerID, serverID).Scan(&count); err != nil {
+		return fmt.Errorf("FAILED TO CHECK OPEN SESSION: %v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	query = "INSERT INTO joueurs_sessions (serveur_id, joueur_id, pseudo, debut) VALUES (?, ?, ?, ?)"
+	_, err := db.Exec(query, serverID, playerID, playerName, ToGoodDatetime(joinedAt))
+	if err != nil {
+		return fmt.Errorf("FAILED TO OPEN SESSION: %v", err)
+	}
+	return nil
+}
+
+// GetOpenSessionPlayerId returns the ID of the player who has an open session on a server under a name, or -1 if there's none
+func GetOpenSessionPlayerId(serverID int, playerName string) (int, error) {
+	query := "SELECT joueur_id FROM joueurs_sessions WHERE serveur_id = ? AND pseudo = ? AND fin IS NULL ORDER BY debut DESC LIMIT 1"
+	var playerID int
+	err := db.QueryRow(query, serverID, playerName).Scan(&playerID)
+	if err == sql.ErrNoRows {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("FAILED TO GET OPEN SESSION PLAYER: %v", err)
+	}
+	return playerID, nil
+}
+
+// ClosePlayerSession closes the open session of a player on a server at the time they left
+// A session never ends before its start, even when the time of a log line is a bit off
+func ClosePlayerSession(playerID int, serverID int, leftAt time.Time) error {
+	query := "UPDATE joueurs_sessions SET fin = GREATEST(debut, ?), duree = GREATEST(TIMESTAMPDIFF(SECOND, debut, ?), 0) WHERE joueur_id = ? AND serveur_id = ? AND fin IS NULL"
+	end := ToGoodDatetime(leftAt)
+	_, err := db.Exec(query, end, end, playerID, serverID)
+	if err != nil {
+		return fmt.Errorf("FAILED TO CLOSE SESSION: %v", err)
+	}
+	return nil
+}
+
+// CloseServerSessions closes every open session of a server at the time it stopped and returns how many were closed
+func CloseServerSessions(serverID int, stoppedAt time.Time) (int64, error) {
+	query := "UPDATE joueurs_sessions SET fin = GREATEST(debut, ?), duree = GREATEST(TIMESTAMPDIFF(SECOND, debut, ?), 0) WHERE serveur_id = ? AND fin IS NULL"
+	end := ToGoodDatetime(stoppedAt)
+	result, err := db.Exec(query, end, end, serverID)
+	if err != nil {
+		return 0, fmt.Errorf("FAILED TO CLOSE SERVER SESSIONS: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// CloseAllPlayerSessions closes every open session, used when the daemon stops, and returns the IDs of the sessions closed
+func CloseAllPlayerSessions() ([]int, error) {
+	if db == nil {
+		return nil, nil
+	}
+	rows, err := db.Query("SELECT id FROM joueurs_sessions WHERE fin IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO GET OPEN SESSIONS: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("FAILED TO SCAN SESSION: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := "UPDATE joueurs_sessions SET fin = ?, duree = TIMESTAMPDIFF(SECOND, debut, ?) WHERE id IN (" + placeholders(len(ids)) + ")"
+	now := GetGoodDatetime()
+	args := []any{now, now}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		return nil, fmt.Errorf("FAILED TO CLOSE SESSIONS: %v", err)
+	}
+	return ids, nil
+}
+
+// ReopenPlayerSessions opens again the sessions closed when the daemon stopped, and returns how many were reopened
+// A player still connected keeps their session, and the lines caught up after the restart close the others at their real time
+// If those lines were lost, like when the log file rotated, the next start of their server closes them
+func ReopenPlayerSessions(ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	query := "UPDATE joueurs_sessions SET fin = NULL, duree = NULL WHERE fin IS NOT NULL AND id IN (" + placeholders(len(ids)) + ")"
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("FAILED TO REOPEN SESSIONS: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// placeholders returns the placeholders of an IN clause
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+// GetPlayerPlaytime returns the time a player played between two dates, on every server
+// Only the part of the sessions inside the dates is counted, an open session counts until now
+func GetPlayerPlaytime(playerID int, from time.Time, to time.Time) (time.Duration, error) {
+	query := `
+		SELECT COALESCE(SUM(TIMESTAMPDIFF(SECOND, GREATEST(debut, ?), LEAST(COALESCE(fin, ?), ?))), 0)
+		FROM joueurs_sessions
+		WHERE joueur_id = ? AND debut < ? AND COALESCE(fin, ?) > ?`
+	now := GetGoodDatetime()
+	var seconds int64
+	err := db.QueryRow(query, from, now, to, playerID, to, now, from).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("FAILED TO GET PLAYER PLAYTIME: %v", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// GetPlayerPlaytimeToday returns the time a player played since midnight
+func GetPlayerPlaytimeToday(playerID int) (time.Duration, error) {
+	now := GetGoodDatetime()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return GetPlayerPlaytime(playerID, midnight, now)
+}
+
+// GetPlayerPlaytimeThisWeek returns the time a player played since Monday
+func GetPlayerPlaytimeThisWeek(playerID int) (time.Duration, error) {
+	now := GetGoodDatetime()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	monday := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, now.Location())
+	return GetPlayerPlaytime(playerID, monday, now)
+}
+
+// GetOnlinePlayers returns the open sessions of a server, or of every server if serverID is 0
+func GetOnlinePlayers(serverID int) ([]models.PlayerSession, error) {
+	query := "SELECT id, serveur_id, joueur_id, debut FROM joueurs_sessions WHERE fin IS NULL AND (? = 0 OR serveur_id = ?) ORDER BY debut"
+	rows, err := db.Query(query, serverID, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO GET ONLINE PLAYERS: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.PlayerSession
+	for rows.Next() {
+		var session models.PlayerSession
+		if err := rows.Scan(&session.ID, &session.ServerID, &session.PlayerID, &session.Start); err != nil {
+			return nil, fmt.Errorf("FAILED TO SCAN SESSION: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// GetPlayerSessions returns the sessions of a player started after a date, the newest first
+func GetPlayerSessions(playerID int, from time.Time) ([]models.PlayerSession, error) {
+	query := "SELECT id, serveur_id, joueur_id, debut, fin, duree FROM joueurs_sessions WHERE joueur_id = ? AND debut >= ? ORDER BY debut DESC"
+	rows, err := db.Query(query, playerID, from)
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO GET PLAYER SESSIONS: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.PlayerSession
+	for rows.Next() {
+		var session models.PlayerSession
+		var end sql.NullString
+		var duration sql.NullInt64
+		if err := rows.Scan(&session.ID, &session.ServerID, &session.PlayerID, &session.Start, &end, &duration); err != nil {
+			return nil, fmt.Errorf("FAILED TO SCAN SESSION: %v", err)
+		}
+		session.End = end.String
+		session.Duration = int(duration.Int64)
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
@@ -65,7 +65,7 @@ func SavePlayerStats(stat models.PlayerStats) error {
 		return fmt.Errorf("❌ Erreur lors de la récupération du joueur avec UUID %s: %v\n", stat.UUID, err)
 	}
 	if playerID == 0 {
-		return fmt.Errorf("⚠️ UUID %s non trouvé dans la base de données, impossible d'enregistrer les stats de %s\n", stat.UUID)
+		return fmt.Errorf("⚠️ UUID %s non trouvé dans la base de données, impossible d'enregistrer les stats\n", stat.UUID)
 	}
 
 	jsonType := "{}"
@@ -139,7 +139,7 @@ func SavePlayerStats(stat models.PlayerStats) error {
 		jsonType,
 	)
 	if err != nil {
-		return fmt.Errorf("❌ Erreur lors de l'éxcécution de la query : \n", err)
+		return fmt.Errorf("❌ Erreur lors de l'éxcécution de la query : %v\n", err)
 	}
 
 	return err
@@ -1,11 +1,7 @@
 package discord
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -21,62 +17,95 @@ func SendDiscordMessage(bot models.BotConfig, channelID string, message string)
 	}
 
 	// Checks if one of the parameters is missing
-	botToken := bot.BotToken
-	switch {
-	case botToken == "" && channelID == "":
-		return fmt.Errorf("ERROR: BOT TOKEN AND CHANNEL ID NOT SET")
-	case botToken == "":
-		return fmt.Errorf("ERROR: BOT TOKEN NOT SET")
-	case channelID == "":
-		return fmt.Errorf("ERROR: CHANNEL ID NOT SET")
+	if err := CheckBotParameters(bot, channelID); err != nil {
+		return err
+	}
+
+	// Finally, send the request
+	_, err := DefaultClient.Do("POST", "/channels/"+channelID+"/messages", bot.BotToken, MessagePayload(message))
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING MESSAGE TO DISCORD: %v", err)
 	}
+	return nil
+}
 
-	// Prepare the request to the Discord API
-	apiURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
-	type DiscordBotMessage struct {
-		Content string `json:"content"`
+func SendDiscordEmbed(bot models.BotConfig, channelID string, title string, description string, color string) error {
+	if !bot.Activated {
+		// fmt.Println("Bot " + bot.BotToken + " is not activated")
+		return nil // If the bot is not activated, we don't send the message
 	}
 
-	// Serialize the message to JSON
-	payload := DiscordBotMessage{Content: message}
-	payloadBytes, err := json.Marshal(payload)
+	// Check required parameters
+	if err := CheckBotParameters(bot, channelID); err != nil {
+		return err
+	}
+
+	payload, err := EmbedPayload(title, description, color)
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE SERIALISING DISCORD MESSAGE: %v", err)
+		return err
 	}
 
-	// Create the HTTP request to send the message
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
+	// Send the request
+	_, err = DefaultClient.Do("POST", "/channels/"+channelID+"/messages", bot.BotToken, payload)
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE CREATING REQUEST TO DISCORD: %v", err)
+		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD: %v", err)
 	}
 
-	// Set the headers for the request
-	req.Header.Set("Authorization", "Bot "+botToken)
-	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
 
-	// Finally, send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func SendDiscordEmbedWithModel(bot models.BotConfig, channelID string, embed models.EmbedConfig) error {
+	if !bot.Activated {
+		// fmt.Println("Bot " + bot.BotToken + " is not activated")
+		return nil // If the bot is not activated, we don't send the message
+	}
+
+	// Check required parameters
+	if err := CheckBotParameters(bot, channelID); err != nil {
+		return err
+	}
+
+	payload, err := EmbedPayloadWithModel(embed)
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE SENDING MESSAGE TO DISCORD: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	// Check the response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("ERROR WHILE SENDING MESSAGE TO DISCORD, RESPONSE STATUS: %v", resp.Status)
-	} else {
-		return nil
+	// Send the request
+	_, err = DefaultClient.Do("POST", "/channels/"+channelID+"/messages", bot.BotToken, payload)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD : %v", err)
 	}
+
+	return nil
 }
 
-func SendDiscordEmbed(bot models.BotConfig, channelID string, title string, description string, color string) error {
+// SendDiscordEmbedWithFile sends an embed with a file attached to a Discord channel
+func SendDiscordEmbedWithFile(bot models.BotConfig, channelID string, title string, description string, color string, file File) error {
 	if !bot.Activated {
-		// fmt.Println("Bot " + bot.BotToken + " is not activated")
 		return nil // If the bot is not activated, we don't send the message
 	}
 
 	// Check required parameters
+	if err := CheckBotParameters(bot, channelID); err != nil {
+		return err
+	}
+
+	payload, err := EmbedPayload(title, description, color)
+	if err != nil {
+		return err
+	}
+
+	// Send the request
+	_, err = DefaultClient.DoMultipart("POST", "/channels/"+channelID+"/messages", bot.BotToken, payload, []File{file})
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING EMBED WITH FILE TO DISCORD: %v", err)
+	}
+
+	return nil
+}
+
+// CheckBotParameters checks that the bot token and the channel ID are set
+func CheckBotParameters(bot models.BotConfig, channelID string) error {
 	botToken := bot.BotToken
 	switch {
 	case botToken == "" && channelID == "":
@@ -86,11 +115,22 @@ func SendDiscordEmbed(bot models.BotConfig, channelID string, title string, desc
 	case channelID == "":
 		return fmt.Errorf("ERROR: CHANNEL ID NOT SET")
 	}
+	return nil
+}
+
+// MessagePayload creates the payload of a text message
+func MessagePayload(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"content": message,
+	}
+}
 
+// EmbedPayload creates the payload of a simple embed message
+func EmbedPayload(title string, description string, color string) (map[string]interface{}, error) {
 	// Convert hex color to integer
 	colorInt, err := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
 	if err != nil {
-		return fmt.Errorf("ERROR: INVALID COLOR FORMAT: %v", err)
+		return nil, fmt.Errorf("ERROR: INVALID COLOR FORMAT: %v", err)
 	}
 
 	// Create the correct payload format
@@ -105,58 +145,15 @@ func SendDiscordEmbed(bot models.BotConfig, channelID string, title string, desc
 		},
 	}
 
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE SERIALIZING DISCORD EMBED: %v", err)
-	}
-
-	// Create and send the request
-	apiURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE CREATING REQUEST TO DISCORD: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bot "+botToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD, RESPONSE STATUS: %v, RESPONSE BODY: %s", resp.Status, string(body))
-	}
-
-	return nil
+	return payload, nil
 }
 
-func SendDiscordEmbedWithModel(bot models.BotConfig, channelID string, embed models.EmbedConfig) error {
-	if !bot.Activated {
-		// fmt.Println("Bot " + bot.BotToken + " is not activated")
-		return nil // If the bot is not activated, we don't send the message
-	}
-
-	// Check required parameters
-	botToken := bot.BotToken
-	switch {
-	case botToken == "" && channelID == "":
-		return fmt.Errorf("ERROR: BOT TOKEN AND CHANNEL ID NOT SET")
-	case botToken == "":
-		return fmt.Errorf("ERROR: BOT TOKEN NOT SET")
-	case channelID == "":
-		return fmt.Errorf("ERROR: CHANNEL ID NOT SET")
-	}
-
+// EmbedPayloadWithModel creates the payload of an embed message from an embed model
+func EmbedPayloadWithModel(embed models.EmbedConfig) (map[string]interface{}, error) {
 	// Convert hex color to integer
 	colorInt, err := strconv.ParseInt(strings.TrimPrefix(embed.Color, "#"), 16, 32)
 	if err != nil {
-		return fmt.Errorf("ERROR: INVALID COLOR FORMAT: %v", err)
+		return nil, fmt.Errorf("ERROR: INVALID COLOR FORMAT: %v", err)
 	}
 
 	// Timestamp
@@ -194,33 +191,5 @@ func SendDiscordEmbedWithModel(bot models.BotConfig, channelID string, embed mod
 		},
 	}
 
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE SERIALIZING DISCORD EMBED: %v", err)
-	}
-
-	// Create and send the request
-	apiURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE CREATING REQUEST TO DISCORD: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bot "+botToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD : %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("ERROR WHILE SENDING EMBED TO DISCORD, RESPONSE STATUS: %v, RESPONSE BODY: %s", resp.Status, string(body))
-	}
-
-	return nil
+	return payload, nil
 }
@@ -0,0 +1,266 @@
+package discord
+
+// This file contains the REST client used for every request sent to the Discord API
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the URL of the Discord API
+const DefaultBaseURL = "https://discord.com/api/v10"
+
+// Number of times a request is sent again after a 429 response before giving up
+const maxRateLimitedRetries = 5
+
+// Client sends requests to the Discord API, waiting for the rate limits and retrying transient errors
+type Client struct {
+	BaseURL    string        // URL of the API, can point to a local stub for tests
+	HTTPClient *http.Client  // HTTP client used for the requests
+	MaxRetries int           // Number of retries after a network error or a 5xx response
+	RetryDelay time.Duration // Delay before the first retry, doubled after each retry
+
+	mutex       sync.Mutex
+	routes      map[string]string           // Route -> bucket ID given by Discord
+	buckets     map[string]*rateLimitBucket // Bucket ID (or route before the first response) -> state
+	globalReset time.Time                   // Time when the global rate limit ends
+}
+
+// rateLimitBucket is the state of a Discord rate limit bucket
+type rateLimitBucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// APIError is returned when Discord answers with an error status
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("DISCORD API RESPONSE STATUS: %v, RESPONSE BODY: %s", e.Status, e.Body)
+}
+
+// File is a file attached to a Discord message
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// NewClient creates a Discord client for the given API URL
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+		MaxRetries: 3,
+		RetryDelay: 500 * time.Millisecond,
+		routes:     map[string]string{},
+		buckets:    map[string]*rateLimitBucket{},
+	}
+}
+
+// DefaultClient is the client used by the send functions of this package
+var DefaultClient = NewClient(DefaultBaseURL)
+
+// SetBaseURL changes the API URL of the default client
+func SetBaseURL(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	DefaultClient.BaseURL = baseURL
+}
+
+// Do sends a request to the Discord API and returns the response body
+// The payload is serialised to JSON, it can be nil for requests without body
+func (c *Client) Do(method string, path string, botToken string, payload any) ([]byte, error) {
+	return c.DoURL(method, c.BaseURL+path, botToken, payload)
+}
+
+// DoURL sends a request to a full Discord URL, like a webhook URL, and returns the response body
+func (c *Client) DoURL(method string, url string, botToken string, payload any) ([]byte, error) {
+	var payloadBytes []byte
+	contentType := ""
+	if payload != nil {
+		var err error
+		payloadBytes, err = json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR WHILE SERIALISING DISCORD PAYLOAD: %v", err)
+		}
+		contentType = "application/json"
+	}
+	return c.send(method, url, botToken, payloadBytes, contentType)
+}
+
+// DoMultipart sends a request with files to the Discord API and returns the response body
+// The payload is sent as the payload_json part, and the files as the files[n] parts
+func (c *Client) DoMultipart(method string, path string, botToken string, payload any, files []File) ([]byte, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR WHILE SERIALISING DISCORD PAYLOAD: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="payload_json"`)
+	header.Set("Content-Type", "application/json")
+	part, err := writer.CreatePart(header)
+	if err == nil {
+		_, err = part.Write(payloadBytes)
+	}
+	for i, file := range files {
+		if err != nil {
+			break
+		}
+		part, err = writer.CreateFormFile("files["+strconv.Itoa(i)+"]", file.Name)
+		if err == nil {
+			_, err = part.Write(file.Content)
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ERROR WHILE CREATING DISCORD MULTIPART BODY: %v", err)
+	}
+
+	return c.send(method, c.BaseURL+path, botToken, body.Bytes(), writer.FormDataContentType())
+}
+
+// send sends a request body to Discord, waiting for the rate limits and retrying transient errors
+func (c *Client) send(method string, url string, botToken string, payloadBytes []byte, contentType string) ([]byte, error) {
+	route := method + " " + url
+	retries := 0
+	rateLimited := 0
+	for {
+		c.waitRateLimit(route)
+
+		req, err := http.NewRequest(method, url, bytes.NewReader(payloadBytes))
+		if err != nil {
+			return nil, fmt.Errorf("ERROR WHILE CREATING REQUEST TO DISCORD: %v", err)
+		}
+		if botToken != "" {
+			req.Header.Set("Authorization", "Bot "+botToken)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			if retries < c.MaxRetries {
+				c.backoff(&retries)
+				continue
+			}
+			return nil, fmt.Errorf("ERROR WHILE SENDING REQUEST TO DISCORD: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ERROR WHILE READING DISCORD RESPONSE: %v", err)
+		}
+
+		c.updateRateLimit(route, resp)
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && rateLimited < maxRateLimitedRetries:
+			// The rate limit state was updated, the next loop waits for it
+			rateLimited++
+			wait := retryAfter(resp, body)
+			fmt.Printf("♟ Discord rate limit reached on %s, retrying in %v.\n", route, wait)
+			time.Sleep(wait)
+			continue
+		case resp.StatusCode >= 500 && retries < c.MaxRetries:
+			c.backoff(&retries)
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			return body, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+		}
+
+		return body, nil
+	}
+}
+
+// backoff waits before retrying a request
+func (c *Client) backoff(retries *int) {
+	time.Sleep(c.RetryDelay * time.Duration(1<<*retries))
+	*retries++
+}
+
+// waitRateLimit waits until the route can be used again
+func (c *Client) waitRateLimit(route string) {
+	c.mutex.Lock()
+	wait := time.Until(c.globalReset)
+	bucketID, exists := c.routes[route]
+	if !exists {
+		bucketID = route
+	}
+	if bucket, exists := c.buckets[bucketID]; exists && bucket.remaining <= 0 {
+		if bucketWait := time.Until(bucket.reset); bucketWait > wait {
+			wait = bucketWait
+		}
+	}
+	c.mutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// updateRateLimit reads the X-RateLimit-* headers of a response
+func (c *Client) updateRateLimit(route string, resp *http.Response) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("X-RateLimit-Global") == "true" {
+		c.globalReset = time.Now().Add(retryAfter(resp, nil))
+	}
+
+	bucketID := resp.Header.Get("X-RateLimit-Bucket")
+	if bucketID == "" {
+		bucketID = route
+	}
+	c.routes[route] = bucketID
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetAfter, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+	c.buckets[bucketID] = &rateLimitBucket{
+		remaining: remaining,
+		reset:     time.Now().Add(time.Duration(resetAfter * float64(time.Second))),
+	}
+}
+
+// retryAfter returns how long to wait after a 429 response
+func retryAfter(resp *http.Response, body []byte) time.Duration {
+	if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	var rateLimitBody struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &rateLimitBody); err == nil && rateLimitBody.RetryAfter > 0 {
+		return time.Duration(rateLimitBody.RetryAfter * float64(time.Second))
+	}
+
+	return time.Second
+}
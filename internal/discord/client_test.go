@@ -0,0 +1,140 @@
+package discord
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubAPI answers the requests with the responses of a list, and records when each request arrived
+type stubAPI struct {
+	mutex     sync.Mutex
+	responses []func(w http.ResponseWriter)
+	requests  []time.Time
+}
+
+func (s *stubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	index := len(s.requests)
+	s.requests = append(s.requests, time.Now())
+	if index < len(s.responses) {
+		s.responses[index](w)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func (s *stubAPI) times() []time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]time.Time(nil), s.requests...)
+}
+
+// newStubClient starts a stub API and returns a client pointing to it
+func newStubClient(t *testing.T, responses ...func(w http.ResponseWriter)) (*Client, *stubAPI) {
+	stub := &stubAPI{responses: responses}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL)
+	client.RetryDelay = 50 * time.Millisecond
+	return client, stub
+}
+
+func status(code int, headers map[string]string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(`{"message":"stub"}`))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	client, stub := newStubClient(t, status(http.StatusTooManyRequests, map[string]string{"Retry-After": "0.2"}))
+
+	if _, err := client.Do("POST", "/channels/1/messages", "token", MessagePayload("test")); err != nil {
+		t.Fatal(err)
+	}
+	times := stub.times()
+	if len(times) != 2 {
+		t.Fatalf("%d requests sent, want 2", len(times))
+	}
+	if wait := times[1].Sub(times[0]); wait < 200*time.Millisecond {
+		t.Errorf("retried after %v, want at least 200ms", wait)
+	}
+}
+
+func TestRateLimitBucket(t *testing.T) {
+	client, stub := newStubClient(t, status(http.StatusOK, map[string]string{
+		"X-RateLimit-Bucket":      "abc",
+		"X-RateLimit-Remaining":   "0",
+		"X-RateLimit-Reset-After": "0.3",
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Do("POST", "/channels/1/messages", "token", MessagePayload("test")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	times := stub.times()
+	if len(times) != 2 {
+		t.Fatalf("%d requests sent, want 2", len(times))
+	}
+	if wait := times[1].Sub(times[0]); wait < 300*time.Millisecond {
+		t.Errorf("second request sent after %v, want the bucket to hold it at least 300ms", wait)
+	}
+}
+
+func TestServerErrorBackoff(t *testing.T) {
+	client, stub := newStubClient(t,
+		status(http.StatusBadGateway, nil),
+		status(http.StatusServiceUnavailable, nil),
+	)
+
+	if _, err := client.Do("GET", "/channels/1", "token", nil); err != nil {
+		t.Fatal(err)
+	}
+	times := stub.times()
+	if len(times) != 3 {
+		t.Fatalf("%d requests sent, want 3", len(times))
+	}
+	// The delay is doubled after each retry
+	if first, second := times[1].Sub(times[0]), times[2].Sub(times[1]); first < 50*time.Millisecond || second < 100*time.Millisecond {
+		t.Errorf("retried after %v then %v, want at least 50ms then 100ms", first, second)
+	}
+
+	// A server that keeps failing gives up after MaxRetries
+	client, stub = newStubClient(t,
+		status(http.StatusInternalServerError, nil),
+		status(http.StatusInternalServerError, nil),
+		status(http.StatusInternalServerError, nil),
+		status(http.StatusInternalServerError, nil),
+	)
+	client.RetryDelay = time.Millisecond
+	_, err := client.Do("GET", "/channels/1", "token", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("error = %v, want a 500 API error", err)
+	}
+	if count := len(stub.times()); count != client.MaxRetries+1 {
+		t.Errorf("%d requests sent, want %d", count, client.MaxRetries+1)
+	}
+}
+
+func TestClientErrorNotRetried(t *testing.T) {
+	client, stub := newStubClient(t, status(http.StatusForbidden, nil))
+
+	_, err := client.Do("POST", "/channels/1/messages", "token", MessagePayload("test"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("error = %v, want a 403 API error", err)
+	}
+	if count := len(stub.times()); count != 1 {
+		t.Errorf("%d requests sent, want 1", count)
+	}
+}
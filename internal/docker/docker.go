@@ -1,51 +1,236 @@
 package docker
 
+// This file contains the client of the Docker Engine API, reached through the unix socket of the daemon
+
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
-    "strings"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
 )
 
-type inspectResult []struct {
-	Mounts []struct {
-		Destination string `json:"Destination"`
-		Source      string `json:"Source"`
-	} `json:"Mounts"`
-}
-
-func GetVolumePath(containerName string) (string, error) {
-    cmd := exec.Command("docker", "inspect", containerName)
-    output, err := cmd.Output()
-    if err != nil {
-        return "", fmt.Errorf("docker inspect failed: %v", err)
-    }
-
-    var result []struct {
-        Mounts []struct {
-            Source      string `json:"Source"`
-            Destination string `json:"Destination"`
-        } `json:"Mounts"`
-    }
-
-    if err := json.Unmarshal(output, &result); err != nil {
-        return "", fmt.Errorf("failed to parse docker inspect output: %v", err)
-    }
-
-    if len(result) == 0 {
-        return "", fmt.Errorf("no inspect data for container %s", containerName)
-    }
-
-    mounts := result[0].Mounts
-    if len(mounts) == 0 {
-        return "", fmt.Errorf("no mounts found in container %s", containerName)
-    }
-
-    for _, mount := range mounts {
-        if !strings.HasPrefix(mount.Source, "/opt/serversentinel") {
-            return mount.Source, nil
-        }
-    }
-
-    return "", fmt.Errorf("no valid mount source found for container %s", containerName)
+// DefaultSocketPath is the socket of the Docker daemon
+const DefaultSocketPath = "/var/run/docker.sock"
+
+// APIVersion is the version of the Engine API used, available since Docker 20.10
+const APIVersion = "v1.41"
+
+// Client sends requests to the Docker Engine API
+type Client struct {
+	SocketPath string
+	HTTPClient *http.Client
+	Timeout    time.Duration // Time given to a request, the stop requests get the stop delay on top of it
+}
+
+// APIError is returned when Docker answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("DOCKER API RESPONSE STATUS: %d, MESSAGE: %s", e.StatusCode, e.Message)
+}
+
+// Container is the part of a container inspection used by the daemon
+type Container struct {
+	ID           string         `json:"Id"`
+	Name         string         `json:"Name"`
+	RestartCount int            `json:"RestartCount"`
+	State        ContainerState `json:"State"`
+	Mounts       []Mount        `json:"Mounts"`
+}
+
+// ContainerState is the state of a container
+type ContainerState struct {
+	Status     string    `json:"Status"` // "created", "running", "paused", "restarting", "removing", "exited" or "dead"
+	Running    bool      `json:"Running"`
+	Restarting bool      `json:"Restarting"`
+	ExitCode   int       `json:"ExitCode"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+	Health     *Health   `json:"Health"` // Nil if the container has no healthcheck
+}
+
+// Health is the result of the healthcheck of a container
+type Health struct {
+	Status        string `json:"Status"` // "starting", "healthy" or "unhealthy"
+	FailingStreak int    `json:"FailingStreak"`
+}
+
+// Mount is a volume or a directory mounted in a container
+type Mount struct {
+	Type        string `json:"Type"`
+	Name        string `json:"Name"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+}
+
+// NewClient creates a client for the Docker daemon listening on a unix socket
+func NewClient(socketPath string) *Client {
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{
+		SocketPath: socketPath,
+		HTTPClient: &http.Client{Transport: transport},
+		Timeout:    30 * time.Second,
+	}
+}
+
+// DefaultClient is the client used by the functions of this package
+var DefaultClient = NewClient(DefaultSocketPath)
+
+// SetSocketPath changes the socket of the default client
+func SetSocketPath(socketPath string) {
+	DefaultClient = NewClient(socketPath)
+}
+
+// Do sends a request to the Engine API and decodes its JSON response in result, result can be nil
+func (c *Client) Do(method string, path string, result any) error {
+	return c.doWithTimeout(method, path, c.Timeout, result)
+}
+
+// doWithTimeout sends a request to the Engine API, giving it the time of timeout to answer
+func (c *Client) doWithTimeout(method string, path string, timeout time.Duration, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker/"+APIVersion+path, nil)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE CREATING DOCKER REQUEST: %v", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING DOCKER REQUEST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE READING DOCKER RESPONSE: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiError) != nil || apiError.Message == "" {
+			apiError.Message = string(body)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: apiError.Message}
+	}
+
+	if result != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, result); err != nil {
+			return fmt.Errorf("ERROR WHILE DECODING DOCKER RESPONSE: %v", err)
+		}
+	}
+	return nil
+}
+
+// InspectContainer returns the state and the mounts of a container, by name or ID
+func (c *Client) InspectContainer(containerName string) (Container, error) {
+	var container Container
+	err := c.Do("GET", "/containers/"+url.PathEscape(containerName)+"/json", &container)
+	return container, err
+}
+
+// StartContainer starts a container, nothing is done if it is already running
+func (c *Client) StartContainer(containerName string) error {
+	return ignoreNotModified(c.Do("POST", "/containers/"+url.PathEscape(containerName)+"/start", nil))
+}
+
+// StopContainer stops a container, it is killed if it doesn't stop before the delay
+// A container stopped this way is not restarted by its restart policy
+func (c *Client) StopContainer(containerName string, delay time.Duration) error {
+	path := fmt.Sprintf("/containers/%s/stop?t=%d", url.PathEscape(containerName), int(delay.Seconds()))
+	return ignoreNotModified(c.doWithTimeout("POST", path, c.Timeout+delay, nil))
+}
+
+// RestartContainer stops then starts a container, it is killed if it doesn't stop before the delay
+func (c *Client) RestartContainer(containerName string, delay time.Duration) error {
+	path := fmt.Sprintf("/containers/%s/restart?t=%d", url.PathEscape(containerName), int(delay.Seconds()))
+	return c.doWithTimeout("POST", path, c.Timeout+delay, nil)
+}
+
+// KillContainer sends a signal to a container, like "SIGKILL"
+func (c *Client) KillContainer(containerName string, signal string) error {
+	return c.Do("POST", "/containers/"+url.PathEscape(containerName)+"/kill?signal="+url.QueryEscape(signal), nil)
+}
+
+// ignoreNotModified ignores the error of a container already in the requested state
+func ignoreNotModified(err error) error {
+	if apiErr, isAPIError := err.(*APIError); isAPIError && apiErr.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	return err
+}
+
+// MountSource returns the path on the host of the mount of a container at a destination, like "/data"
+func (container Container) MountSource(destination string) (string, bool) {
+	for _, mount := range container.Mounts {
+		if mount.Destination == destination {
+			return mount.Source, true
+		}
+	}
+	return "", false
+}
+
+// IsContainerName returns false for the values of the contenaire column used when a server has no container
+func IsContainerName(containerName string) bool {
+	switch containerName {
+	case "", "depreciated", "NULL", "null":
+		return false
+	}
+	return true
+}
+
+// InspectContainer returns the state and the mounts of a container with the default client
+func InspectContainer(containerName string) (Container, error) {
+	return DefaultClient.InspectContainer(containerName)
+}
+
+// StartContainer starts a container with the default client
+func StartContainer(containerName string) error {
+	return DefaultClient.StartContainer(containerName)
+}
+
+// StopContainer stops a container with the default client
+func StopContainer(containerName string, delay time.Duration) error {
+	return DefaultClient.StopContainer(containerName, delay)
+}
+
+// RestartContainer restarts a container with the default client
+func RestartContainer(containerName string, delay time.Duration) error {
+	return DefaultClient.RestartContainer(containerName, delay)
+}
+
+// KillContainer sends a signal to a container with the default client
+func KillContainer(containerName string, signal string) error {
+	return DefaultClient.KillContainer(containerName, signal)
+}
+
+// GetVolumePath returns the path on the host of the mount of a container at a destination, like "/data"
+func GetVolumePath(containerName string, destination string) (string, error) {
+	container, err := InspectContainer(containerName)
+	if err != nil {
+		return "", fmt.Errorf("ERROR WHILE INSPECTING CONTAINER %s: %v", containerName, err)
+	}
+
+	source, found := container.MountSource(destination)
+	if !found {
+		return "", fmt.Errorf("ERROR: NO MOUNT ON %s IN CONTAINER %s", destination, containerName)
+	}
+	return source, nil
 }
@@ -0,0 +1,178 @@
+package docker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const inspectResponse = `{
+	"Id": "abc123",
+	"Name": "/mc-vanilla",
+	"RestartCount": 2,
+	"State": {
+		"Status": "running",
+		"Running": true,
+		"Restarting": false,
+		"ExitCode": 0,
+		"StartedAt": "2025-01-12T18:03:44.123456789Z",
+		"FinishedAt": "0001-01-01T00:00:00Z",
+		"Health": {"Status": "healthy", "FailingStreak": 0}
+	},
+	"Mounts": [
+		{"Type": "bind", "Source": "/opt/serversentinel/serverslog", "Destination": "/logs"},
+		{"Type": "volume", "Name": "mc-vanilla-data", "Source": "/var/lib/docker/volumes/mc-vanilla-data/_data", "Destination": "/data"},
+		{"Type": "bind", "Source": "/srv/backups", "Destination": "/backups"}
+	]
+}`
+
+// startFakeDocker starts a Docker Engine API stand-in on a unix socket and returns a client for it
+func startFakeDocker(t *testing.T, handler http.HandlerFunc) *Client {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return NewClient(socketPath)
+}
+
+func fakeInspectHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("method = %s", r.Method)
+		}
+		switch r.URL.Path {
+		case "/" + APIVersion + "/containers/mc-vanilla/json":
+			w.Write([]byte(inspectResponse))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: absent"}`))
+		}
+	}
+}
+
+func TestInspectContainer(t *testing.T) {
+	client := startFakeDocker(t, fakeInspectHandler(t))
+
+	container, err := client.InspectContainer("mc-vanilla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.ID != "abc123" || container.RestartCount != 2 {
+		t.Errorf("container = %+v", container)
+	}
+	state := container.State
+	if state.Status != "running" || !state.Running || state.Health == nil || state.Health.Status != "healthy" {
+		t.Errorf("state = %+v", state)
+	}
+	if want := time.Date(2025, 1, 12, 18, 3, 44, 123456789, time.UTC); !state.StartedAt.Equal(want) {
+		t.Errorf("StartedAt = %v", state.StartedAt)
+	}
+}
+
+func TestMountSource(t *testing.T) {
+	client := startFakeDocker(t, fakeInspectHandler(t))
+	container, err := client.InspectContainer("mc-vanilla")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, found := container.MountSource("/data")
+	if !found || source != "/var/lib/docker/volumes/mc-vanilla-data/_data" {
+		t.Errorf("MountSource(/data) = %q, %v", source, found)
+	}
+	if _, found := container.MountSource("/world"); found {
+		t.Error("MountSource() of a destination without mount found one")
+	}
+}
+
+func TestInspectContainerNotFound(t *testing.T) {
+	client := startFakeDocker(t, fakeInspectHandler(t))
+
+	_, err := client.InspectContainer("absent")
+	apiErr, isAPIError := err.(*APIError)
+	if !isAPIError || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: absent" {
+		t.Errorf("InspectContainer() of a missing container = %v", err)
+	}
+}
+
+func TestGetVolumePath(t *testing.T) {
+	previous := DefaultClient
+	DefaultClient = startFakeDocker(t, fakeInspectHandler(t))
+	t.Cleanup(func() { DefaultClient = previous })
+
+	path, err := GetVolumePath("mc-vanilla", "/data")
+	if err != nil || path != "/var/lib/docker/volumes/mc-vanilla-data/_data" {
+		t.Errorf("GetVolumePath() = %q, %v", path, err)
+	}
+	if _, err := GetVolumePath("mc-vanilla", "/world"); err == nil {
+		t.Error("GetVolumePath() of a destination without mount returned no error")
+	}
+	if _, err := GetVolumePath("absent", "/data"); err == nil {
+		t.Error("GetVolumePath() of a missing container returned no error")
+	}
+}
+
+func TestDaemonNotRunning(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "absent.sock"))
+	if _, err := client.InspectContainer("mc-vanilla"); err == nil {
+		t.Error("InspectContainer() without daemon returned no error")
+	}
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	var requests []string
+	client := startFakeDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		switch r.URL.Path {
+		case "/" + APIVersion + "/containers/mc-vanilla/start":
+			w.WriteHeader(http.StatusNotModified) // Already running
+		case "/" + APIVersion + "/containers/absent/stop":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: absent"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	if err := client.StartContainer("mc-vanilla"); err != nil {
+		t.Errorf("StartContainer() of a running container = %v", err)
+	}
+	if err := client.StopContainer("mc-vanilla", 45*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := client.RestartContainer("mc-vanilla", 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := client.KillContainer("mc-vanilla", "SIGKILL"); err != nil {
+		t.Error(err)
+	}
+	if err := client.StopContainer("absent", time.Second); err == nil {
+		t.Error("StopContainer() of a missing container returned no error")
+	}
+
+	want := []string{
+		"POST /" + APIVersion + "/containers/mc-vanilla/start",
+		"POST /" + APIVersion + "/containers/mc-vanilla/stop?t=45",
+		"POST /" + APIVersion + "/containers/mc-vanilla/restart?t=10",
+		"POST /" + APIVersion + "/containers/mc-vanilla/kill?signal=SIGKILL",
+		"POST /" + APIVersion + "/containers/absent/stop?t=1",
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %v", requests)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d = %q, want %q", i, requests[i], want[i])
+		}
+	}
+}
@@ -23,11 +23,6 @@ func Task() {
 	fmt.Println("♟ Periodic task executed at", time.Now().Format("02/01/2006 15:04:05"))
 }
 
-// Task : Server check
-func TaskServerCheck() {
-	/* Deprecated, need to be updated */
-}
-
 // Task : Minecraft statistics update
 func TaskMinecraftStatsUpdate() {
 	err := db.ConnectToDatabase()
@@ -42,7 +37,8 @@ func TaskMinecraftStatsUpdate() {
 
 	sqlDB, err := sql.Open("mysql", dsn)
 	if err != nil {
-		fmt.Errorf("Database connection failed:", err)
+		fmt.Println("Database connection failed:", err)
+		return
 	}
 	defer sqlDB.Close()
 
@@ -50,7 +46,7 @@ func TaskMinecraftStatsUpdate() {
 
 	fmt.Println("🔄 Synchronisation des stats Minecraft...")
 	if err := minecraft_stats.SyncMinecraftStats(); err != nil {
-		fmt.Errorf("Erreur synchronisation:", err)
+		fmt.Println("Erreur synchronisation:", err)
 	}
 	fmt.Println("✅ Stats Minecraft synchronisées.")
 }
@@ -84,16 +80,8 @@ func StartPeriodicTask(PeriodicEventsMin int) error {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		// Execute the periodic task : Log the time and send a message to Discord
+		// Execute the periodic task : Log the time, the state of the servers is shown by the status messages
 		Task()
-		discord.SendDiscordEmbed(config.AppConfig.Bots["mineotterBot"], config.AppConfig.DiscordChannels.ServerStatusChannelID, "♟ "+time.Now().Format("02/01/2006 15:04:05"), "Periodic task executed.", goodColor)
-
-		// Check if the right tmux servers are running
-		if config.AppConfig.PeriodicEvents.ServersCheckEnabled {
-			TaskServerCheck()
-		} else {
-			fmt.Println("♟ Server check is disabled.")
-		}
 
 		// Get the minecraft player game statistics
 		if config.AppConfig.PeriodicEvents.MinecraftStatsEnabled {
@@ -0,0 +1,307 @@
+package periodic
+
+// This file contains the health check of the servers
+// Each active server of the serveurs table is probed, and the changes of state are posted in the bot admin channel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/console"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/docker"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+	"github.com/Corentin-cott/ServerSentinel/internal/recovery"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+// Health states of a server
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// Time given to each network probe
+const probeTimeout = 5 * time.Second
+
+// ServerHealth is the result of the health check of a server
+type ServerHealth struct {
+	ServerID  int
+	Name      string
+	Status    string // HealthUp, HealthDegraded or HealthDown
+	Probes    []ProbeResult
+	CheckedAt time.Time
+}
+
+// ProbeResult is the result of one probe of a server
+type ProbeResult struct {
+	Name   string // "ping", "rcon", "api", "docker", "healthcheck", "logs" or "restarts"
+	OK     bool
+	Detail string
+}
+
+var (
+	healths        = map[int]ServerHealth{}
+	healthsMutex   sync.RWMutex
+	checkStartedAt = time.Now() // Reference for the log freshness of the servers without line since the start
+)
+
+// StartServerCheck checks the servers now, then at each interval
+func StartServerCheck(interval time.Duration) {
+	for {
+		TaskServerCheck()
+		time.Sleep(interval)
+	}
+}
+
+// Task : Server check
+func TaskServerCheck() {
+	servers, err := db.GetAllServers()
+	if err != nil {
+		fmt.Println("✘ Error while getting the servers to check:", err)
+		return
+	}
+
+	for _, serv := range servers {
+		if !serv.Actif {
+			continue
+		}
+		health := checkServer(serv)
+		if health.Status == "" {
+			continue // Nothing could be probed
+		}
+		if health.Status == HealthDown {
+			recovery.ServerDown(serv.ID, failedProbes(health))
+		}
+		if recovery.IsExhausted(serv.ID) {
+			// The server is left to the admins, it stays degraded until it starts again
+			health.Probes = append(health.Probes, ProbeResult{Name: "restarts", Detail: "limite de redémarrages automatiques atteinte"})
+			health.Status = HealthDegraded
+		}
+
+		healthsMutex.Lock()
+		previous, known := healths[serv.ID]
+		healths[serv.ID] = health
+		healthsMutex.Unlock()
+
+		if (known && previous.Status != health.Status) || (!known && health.Status != HealthUp) {
+			notifyHealthChange(serv, health)
+		}
+	}
+}
+
+// failedProbes returns the details of the failed probes of a server
+func failedProbes(health ServerHealth) string {
+	var failed []string
+	for _, probe := range health.Probes {
+		if !probe.OK {
+			failed = append(failed, probe.Name+" : "+probe.Detail)
+		}
+	}
+	return strings.Join(failed, ", ")
+}
+
+// GetServerHealth returns the result of the last health check of a server
+func GetServerHealth(serverID int) (ServerHealth, bool) {
+	healthsMutex.RLock()
+	defer healthsMutex.RUnlock()
+	health, exists := healths[serverID]
+	return health, exists
+}
+
+// GetAllServerHealth returns the result of the last health check of every server, sorted by server ID
+func GetAllServerHealth() []ServerHealth {
+	healthsMutex.RLock()
+	defer healthsMutex.RUnlock()
+
+	var result []ServerHealth
+	for _, health := range healths {
+		result = append(result, health)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ServerID < result[j].ServerID })
+	return result
+}
+
+// checkServer probes a server
+// The game probes need the server in the configuration, the container probe only needs the contenaire column
+func checkServer(serv models.Server) ServerHealth {
+	health := ServerHealth{ServerID: serv.ID, Name: serv.Nom, CheckedAt: time.Now()}
+
+	server, registered := db.GetServerConfigById(serv.ID)
+	if registered {
+		switch serv.Jeu {
+		case "Minecraft":
+			health.Probes = append(health.Probes, probePing(server))
+			if _, _, password := db.GetRconAddress(server); password != "" {
+				health.Probes = append(health.Probes, probeRcon(server))
+			}
+		case "Palworld":
+			health.Probes = append(health.Probes, probePalworld(server))
+		}
+		if !server.Disabled && config.AppConfig.PeriodicEvents.LogStaleMin > 0 {
+			health.Probes = append(health.Probes, probeLogs(server))
+		}
+	}
+	if docker.IsContainerName(serv.Contenaire) {
+		health.Probes = append(health.Probes, probeContainer(serv.Contenaire)...)
+	}
+
+	health.Status = healthStatus(health.Probes)
+	return health
+}
+
+// healthStatus returns the state of a server from its probes
+// A stopped container is enough to be down, the other failed probes only make the server degraded
+func healthStatus(probes []ProbeResult) string {
+	if len(probes) == 0 {
+		return ""
+	}
+
+	failed := 0
+	for _, probe := range probes {
+		if !probe.OK {
+			if probe.Name == "docker" {
+				return HealthDown
+			}
+			failed++
+		}
+	}
+
+	switch failed {
+	case 0:
+		return HealthUp
+	case len(probes):
+		return HealthDown
+	default:
+		return HealthDegraded
+	}
+}
+
+// probePing checks that a Minecraft server answers the server list ping
+func probePing(server models.ServerConfig) ProbeResult {
+	host, port := db.GetGameAddress(server)
+	status, err := services.PingMinecraftServer(host, port, probeTimeout)
+	if err != nil {
+		return ProbeResult{Name: "ping", Detail: err.Error()}
+	}
+	detail := fmt.Sprintf("%s, %d/%d joueurs, %dms", status.Version, status.OnlinePlayers, status.MaxPlayers, status.Latency.Milliseconds())
+	return ProbeResult{Name: "ping", OK: true, Detail: detail}
+}
+
+// probeRcon checks that the RCON password of a Minecraft server is accepted
+// The roster already sends "list" to the server at each reconciliation, so the result of the last command is used when it's recent
+func probeRcon(server models.ServerConfig) ProbeResult {
+	health := db.GetServerRconHealth(server)
+	lastCommand := health.LastSuccess
+	if health.LastFailure.After(lastCommand) {
+		lastCommand = health.LastFailure
+	}
+	maxAge := 2 * time.Duration(config.AppConfig.RosterReconcileSec) * time.Second
+	if !lastCommand.IsZero() && time.Since(lastCommand) < maxAge {
+		if health.LastFailure.After(health.LastSuccess) {
+			return ProbeResult{Name: "rcon", Detail: health.LastError}
+		}
+		return ProbeResult{Name: "rcon", OK: true, Detail: "authentifié"}
+	}
+
+	host, port, password := db.GetRconAddress(server)
+	_, err := services.ExecuteRcon(host, port, password, "list")
+	if err != nil {
+		return ProbeResult{Name: "rcon", Detail: err.Error()}
+	}
+	return ProbeResult{Name: "rcon", OK: true, Detail: "authentifié"}
+}
+
+// probePalworld checks that a Palworld server answers on its REST API or with RCON
+func probePalworld(server models.ServerConfig) ProbeResult {
+	client := db.GetPalworldClient(server)
+	name := "rcon"
+	if client.RestURL != "" {
+		name = "api"
+	}
+
+	info, err := client.Info()
+	if err != nil {
+		return ProbeResult{Name: name, Detail: err.Error()}
+	}
+	return ProbeResult{Name: name, OK: true, Detail: info.Version}
+}
+
+// probeContainer checks that the container of a server is running, and healthy if it has a healthcheck
+func probeContainer(containerName string) []ProbeResult {
+	container, err := docker.InspectContainer(containerName)
+	if err != nil {
+		return []ProbeResult{{Name: "docker", Detail: err.Error()}}
+	}
+
+	state := container.State
+	detail := containerName + " " + state.Status
+	if state.Running {
+		detail += " depuis le " + state.StartedAt.Local().Format("02/01 à 15:04")
+	} else if state.Status == "exited" {
+		detail += fmt.Sprintf(" (code %d)", state.ExitCode)
+	}
+	if container.RestartCount > 0 {
+		detail += fmt.Sprintf(", %d redémarrages", container.RestartCount)
+	}
+	probes := []ProbeResult{{Name: "docker", OK: state.Running && !state.Restarting, Detail: detail}}
+
+	if state.Health != nil && state.Running {
+		probes = append(probes, ProbeResult{
+			Name:   "healthcheck",
+			OK:     state.Health.Status != "unhealthy",
+			Detail: fmt.Sprintf("%s (%d échecs consécutifs)", state.Health.Status, state.Health.FailingStreak),
+		})
+	}
+	return probes
+}
+
+// probeLogs checks that a server wrote in its log file recently
+func probeLogs(server models.ServerConfig) ProbeResult {
+	lastLine := console.GetLastLogLineTime(server.Name)
+	reference := lastLine
+	if reference.IsZero() {
+		reference = checkStartedAt
+	}
+
+	age := time.Since(reference).Round(time.Minute)
+	maxAge := time.Duration(config.AppConfig.PeriodicEvents.LogStaleMin) * time.Minute
+	if lastLine.IsZero() {
+		return ProbeResult{Name: "logs", OK: age < maxAge, Detail: fmt.Sprintf("aucune ligne depuis %v", age)}
+	}
+	return ProbeResult{Name: "logs", OK: age < maxAge, Detail: fmt.Sprintf("dernière ligne il y a %v", age)}
+}
+
+// notifyHealthChange posts the new state of a server in the bot admin channel
+func notifyHealthChange(serv models.Server, health ServerHealth) {
+	var title, color string
+	switch health.Status {
+	case HealthUp:
+		title, color = "🟢 "+serv.Nom+" répond de nouveau", goodColor
+	case HealthDegraded:
+		title, color = "🟠 "+serv.Nom+" est dégradé", mehColor
+	default:
+		title, color = "🔴 "+serv.Nom+" ne répond plus", badColor
+	}
+
+	var lines []string
+	for _, probe := range health.Probes {
+		symbol := "✘"
+		if probe.OK {
+			symbol = "✔"
+		}
+		lines = append(lines, symbol+" **"+probe.Name+"** : "+probe.Detail)
+	}
+
+	fmt.Printf("♟ Health of %s is now %s.\n", serv.Nom, health.Status)
+	err := outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.BotAdminChannelID, title, strings.Join(lines, "\n"), color)
+	if err != nil {
+		fmt.Println("✘ Error while sending the health notice of "+serv.Nom+":", err)
+	}
+}
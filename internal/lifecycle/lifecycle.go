@@ -0,0 +1,277 @@
+package lifecycle
+
+// The lifecycle starts, stops, restarts and kills the servers through their container, or their tmux session without container
+// A Minecraft server is stopped with RCON first, so the world is saved before the container stops
+// The servers stopped here are written in the stopped servers file, so the automatic restarts leave them stopped
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/console"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/docker"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+	"github.com/Corentin-cott/ServerSentinel/internal/tmux"
+)
+
+const (
+	stoppingLineTimeout = 30 * time.Second // Time given to a Minecraft server to write its stopping line after the stop command
+	stopDelay           = 60 * time.Second // Time given to a container to stop before it is killed
+)
+
+var (
+	stoppingLineRegex = regexp.MustCompile(`Stopping the server`)
+	stoppedMutex      sync.Mutex
+)
+
+// getServer returns the server row and the registered server of a server ID
+func getServer(serverID int) (models.Server, models.ServerConfig, error) {
+	serv, err := db.GetServerById(serverID)
+	if err != nil {
+		return serv, models.ServerConfig{}, fmt.Errorf("ERROR WHILE GETTING SERVER %d: %v", serverID, err)
+	}
+	server, _ := db.GetServerConfigById(serverID) // The container is enough to start or kill a server
+	return serv, server, nil
+}
+
+// getContainer returns the container of a server
+// A server without container but with a start command is run in a tmux session, and the container returned is empty
+func getContainer(serv models.Server, server models.ServerConfig) (string, error) {
+	if docker.IsContainerName(serv.Contenaire) {
+		return serv.Contenaire, nil
+	}
+	if server.StartCommand != "" {
+		return "", nil
+	}
+	return "", fmt.Errorf("ERROR: SERVER %s HAS NO CONTAINER AND NO START COMMAND", serv.Nom)
+}
+
+// StartServer starts the container or the tmux session of a server
+func StartServer(serverID int) error {
+	serv, server, err := getServer(serverID)
+	if err != nil {
+		return err
+	}
+	container, err := getContainer(serv, server)
+	if err != nil {
+		return err
+	}
+
+	if container == "" {
+		err = tmux.StartServer(server)
+	} else {
+		err = docker.StartContainer(container)
+	}
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE STARTING SERVER %s: %v", serv.Nom, err)
+	}
+	setStoppedOnPurpose(serverID, false)
+	fmt.Printf("✔ Server %s started.\n", serv.Nom)
+	return nil
+}
+
+// StopServer stops a server and its container
+// A Minecraft server receives save-all and stop with RCON, and its container is stopped once it wrote its stopping line
+func StopServer(serverID int) error {
+	return stopServer(serverID, true)
+}
+
+// stopServer stops a server, and writes it in the stopped servers file if it's stopped on purpose
+func stopServer(serverID int, onPurpose bool) error {
+	serv, server, err := getServer(serverID)
+	if err != nil {
+		return err
+	}
+	container, err := getContainer(serv, server)
+	if err != nil {
+		return err
+	}
+	if onPurpose {
+		setStoppedOnPurpose(serverID, true)
+	}
+
+	if container == "" {
+		if serv.Jeu == "Palworld" {
+			if err := db.GetPalworldClient(server).Save(); err != nil {
+				fmt.Println("✘ Error while saving "+serv.Nom+" before stopping it:", err)
+			}
+		}
+		// The stop command of a Minecraft server saves the world
+		if err := tmux.StopServer(server, stopDelay); err != nil {
+			return fmt.Errorf("ERROR WHILE STOPPING SERVER %s: %v", serv.Nom, err)
+		}
+		fmt.Printf("✔ Server %s stopped.\n", serv.Nom)
+		return nil
+	}
+
+	inspection, err := docker.InspectContainer(container)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE INSPECTING SERVER %s: %v", serv.Nom, err)
+	}
+	if !inspection.State.Running {
+		fmt.Printf("♟ Server %s is already stopped.\n", serv.Nom)
+		return nil
+	}
+
+	if server.Name != "" {
+		switch serv.Jeu {
+		case "Minecraft":
+			stopMinecraftServer(serv, server)
+		case "Palworld":
+			if err := db.GetPalworldClient(server).Save(); err != nil {
+				fmt.Println("✘ Error while saving "+serv.Nom+" before stopping it:", err)
+			}
+		}
+	}
+
+	// The container is stopped even when the server stopped by itself, so its restart policy doesn't start it again
+	if err := docker.StopContainer(container, stopDelay); err != nil {
+		return fmt.Errorf("ERROR WHILE STOPPING SERVER %s: %v", serv.Nom, err)
+	}
+	fmt.Printf("✔ Server %s stopped.\n", serv.Nom)
+	return nil
+}
+
+// stopMinecraftServer saves the world and stops a Minecraft server with RCON, then waits for its stopping line
+// If RCON doesn't answer, the container stop is left to stop the server
+func stopMinecraftServer(serv models.Server, server models.ServerConfig) {
+	waiter, err := console.ExpectLogLine(server, stoppingLineRegex)
+	if err != nil {
+		fmt.Println("✘ The stopping line of "+serv.Nom+" can't be waited for:", err)
+	}
+
+	host, port, password := db.GetRconAddress(server)
+	if _, err := services.SendRconToMinecraftServer(host, port, password, "save-all"); err != nil {
+		fmt.Println("✘ Error while saving "+serv.Nom+" before stopping it:", err)
+	}
+	if _, err := services.SendRconToMinecraftServer(host, port, password, "stop"); err != nil {
+		fmt.Println("✘ Error while stopping "+serv.Nom+" with RCON:", err)
+		if waiter != nil {
+			waiter.Close()
+		}
+		return
+	}
+
+	if waiter == nil {
+		return
+	}
+	if _, found := waiter.Wait(stoppingLineTimeout); found {
+		fmt.Printf("♟ Server %s is stopping.\n", serv.Nom)
+	} else {
+		fmt.Printf("✘ Server %s didn't write its stopping line, its container will be stopped.\n", serv.Nom)
+	}
+}
+
+// RestartServer stops a server like StopServer, then starts it again
+func RestartServer(serverID int) error {
+	if err := StopServer(serverID); err != nil {
+		return err
+	}
+	return StartServer(serverID)
+}
+
+// RecoverServer stops what is left of a failed server and starts it again, for the automatic restarts
+// The server isn't written in the stopped servers file, so a failed start leaves it to its restart policy
+func RecoverServer(serverID int) error {
+	if err := stopServer(serverID, false); err != nil {
+		return err
+	}
+	return StartServer(serverID)
+}
+
+// KillServer kills the container or the tmux session of a server, without saving it
+func KillServer(serverID int) error {
+	serv, server, err := getServer(serverID)
+	if err != nil {
+		return err
+	}
+	container, err := getContainer(serv, server)
+	if err != nil {
+		return err
+	}
+	setStoppedOnPurpose(serverID, true)
+
+	if container == "" {
+		err = tmux.KillSession(tmux.SessionName(server))
+	} else {
+		err = docker.KillContainer(container, "SIGKILL")
+	}
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE KILLING SERVER %s: %v", serv.Nom, err)
+	}
+	fmt.Printf("✔ Server %s killed.\n", serv.Nom)
+	return nil
+}
+
+// StoppedOnPurpose returns true if a server was stopped or killed here, and not started again since
+// The file is read each time, because the CLI commands run in another process than the daemon
+func StoppedOnPurpose(serverID int) bool {
+	stoppedMutex.Lock()
+	defer stoppedMutex.Unlock()
+
+	_, stopped := readStoppedServers()[strconv.Itoa(serverID)]
+	return stopped
+}
+
+// setStoppedOnPurpose adds a server to the stopped servers file, or removes it
+func setStoppedOnPurpose(serverID int, stopped bool) {
+	stoppedMutex.Lock()
+	defer stoppedMutex.Unlock()
+
+	servers := readStoppedServers()
+	key := strconv.Itoa(serverID)
+	if _, exists := servers[key]; exists == stopped {
+		return
+	}
+	if stopped {
+		servers[key] = time.Now()
+	} else {
+		delete(servers, key)
+	}
+
+	if err := writeStoppedServers(servers); err != nil {
+		fmt.Println("✘ Error while writing the stopped servers file:", err)
+	}
+}
+
+// readStoppedServers reads the stopped servers file, the keys are the server IDs and the values the stop times
+func readStoppedServers() map[string]time.Time {
+	servers := map[string]time.Time{}
+	content, err := os.ReadFile(config.AppConfig.StoppedServersFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("✘ Error while reading the stopped servers file:", err)
+		}
+		return servers
+	}
+	if err := json.Unmarshal(content, &servers); err != nil {
+		fmt.Println("✘ Error while reading the stopped servers file:", err)
+	}
+	return servers
+}
+
+// writeStoppedServers writes the stopped servers file through a temporary file, so it is never half written
+func writeStoppedServers(servers map[string]time.Time) error {
+	content, err := json.MarshalIndent(servers, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := config.AppConfig.StoppedServersFile
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
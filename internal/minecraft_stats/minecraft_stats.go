@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Corentin-cott/ServerSentinel/config"
 	"github.com/Corentin-cott/ServerSentinel/internal/db_stats"
 	"github.com/Corentin-cott/ServerSentinel/internal/docker"
 	"github.com/Corentin-cott/ServerSentinel/internal/models"
@@ -23,11 +24,11 @@ func SyncMinecraftStats() error {
 	}
 
 	for _, serv := range servers {
-		if serv.Contenaire == "depreciated" || serv.Contenaire == "NULL" || serv.Contenaire == "null" {
+		if !docker.IsContainerName(serv.Contenaire) {
 			fmt.Printf("🔀 No container for %s, skipping.\n", serv.Nom)
 			continue
 		}
-		volumePath, err := docker.GetVolumePath(serv.Contenaire)
+		volumePath, err := docker.GetVolumePath(serv.Contenaire, config.AppConfig.Docker.DataDestination)
 		fmt.Printf("🔄 Récupération des stats pour le serveur %s (%s)...\n", serv.Nom, volumePath)
 		if err != nil {
 			fmt.Printf("❌ Container %s inaccessible: %v\n", serv.Contenaire, err)
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // DatabaseConfig is a struct that contains the configuration for the database
 type DatabaseConfig struct {
 	Host     string `json:"host"`
@@ -15,12 +17,103 @@ type BotConfig struct {
 	BotToken  string `json:"botToken"`
 }
 
+// InteractionsConfig is a struct that contains the configuration of the Discord slash commands
+type InteractionsConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Bot           string   `json:"bot"`           // Bot name in the bots section, used to register the commands
+	ApplicationID string   `json:"applicationID"` // ID of the Discord application of the bot
+	PublicKey     string   `json:"publicKey"`     // Public key of the Discord application, used to verify the requests
+	GuildID       string   `json:"guildID"`       // If set, the commands are registered for this guild only
+	ListenAddress string   `json:"listenAddress"` // Address of the interactions endpoint, like ":8080"
+	AdminRoles    []string `json:"adminRoles"`    // IDs of the Discord roles allowed to use the admin commands
+}
+
+// ChatBridgeConfig is a struct that contains the configuration of the Discord to game chat bridge
+type ChatBridgeConfig struct {
+	Enabled             bool                `json:"enabled"`
+	Bot                 string              `json:"bot"`                 // Bot name in the bots section, used to read the channels
+	PollIntervalSec     int                 `json:"pollIntervalSec"`     // Delay between two reads of the channels
+	IdlePollIntervalSec int                 `json:"idlePollIntervalSec"` // Longest delay between two reads, reached while the channels are quiet
+	Channels            []ChatBridgeChannel `json:"channels"`            // If empty, the Minecraft chat channel is relayed to every bridge group
+}
+
+// StatusMessageConfig is a struct that contains the configuration of the status messages edited in place in Discord
+type StatusMessageConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Bot          string `json:"bot"`          // Bot name in the bots section, used to send and edit the messages
+	ChannelID    string `json:"channelID"`    // If empty, the server status channel is used
+	IntervalSec  int    `json:"intervalSec"`  // Delay between two updates of the messages
+	MessagesFile string `json:"messagesFile"` // File keeping the IDs of the messages, so they are still edited after a restart
+}
+
+// ChatBridgeChannel is a Discord channel relayed to the servers of a bridge group
+type ChatBridgeChannel struct {
+	ChannelID   string `json:"channelID"`
+	BridgeGroup string `json:"bridgeGroup"` // If empty, the messages are relayed to every bridged server
+}
+
 // DiscordWebhookConfig is a struct that contains the configuration for a Discord webhook
 type DiscordWebhookConfig struct {
 	Enabled bool   `json:"enabled"`
 	URL     string `json:"url"`
 }
 
+// ServerConfig is a struct that maps a log source to a server, its webhook and its chat bridge group
+// The server is resolved with ServerID if set, else with ServerName (serveurs.nom), else with Role (serveurs_parameters)
+type ServerConfig struct {
+	Name         string `json:"name"`         // Name used in the daemon logs and commands
+	LogFile      string `json:"logFile"`      // Log file name in the serverslog directory (or absolute path)
+	ServerID     int    `json:"serverID"`     // ID of the server in the serveurs table
+	ServerName   string `json:"serverName"`   // Name of the server in the serveurs table
+	Role         string `json:"role"`         // "primary", "secondary" or "partner", resolved with serveurs_parameters
+	Game         string `json:"game"`         // "Minecraft" or "Palworld", used when the server row is not available
+	Webhook      string `json:"webhook"`      // Key of the webhook in discordWebhooks used to mirror the console
+	BridgeGroup  string `json:"bridgeGroup"`  // Servers sharing the same bridge group relay chat, joins and leaves
+	BridgeTag    string `json:"bridgeTag"`    // Tag shown before the messages relayed from this server, like "[Vanilla]"
+	RconHost     string `json:"rconHost"`     // If empty, the host is read from serveurs_parameters
+	RconPort     int    `json:"rconPort"`     // If 0, the port is read from serveurs_parameters
+	RconPassword string `json:"rconPassword"` // If empty, the password is read from serveurs_parameters
+	RestURL      string `json:"restURL"`      // Palworld only, URL of the REST API like "http://127.0.0.1:8212"
+	RestPassword string `json:"restPassword"` // Palworld only, admin password of the REST API, if empty the RCON password is used
+	GameHost     string `json:"gameHost"`     // Minecraft only, host of the server list ping, if empty the RCON host is used
+	GamePort     int    `json:"gamePort"`     // Minecraft only, port of the server list ping, if 0 the port 25565 is used
+	StartCommand string `json:"startCommand"` // Command starting the server in its tmux session, like "java -Xmx6G -jar server.jar nogui"
+	StopCommand  string `json:"stopCommand"`  // Console command stopping the server in its tmux session, like "stop"
+	WorkDir      string `json:"workDir"`      // Directory where the start command is run
+	TmuxSession  string `json:"tmuxSession"`  // Name of the tmux session, if empty "serversentinel-" and the server name
+	Disabled     bool   `json:"disabled"`     // If true, the log file is not listened to
+
+	MirrorInclude []string `json:"mirrorInclude"` // If set, only the console lines matching one of these regexes are sent to the webhook
+	MirrorExclude []string `json:"mirrorExclude"` // Console lines matching one of these regexes are not sent to the webhook
+
+	RestartPolicy   RestartPolicyConfig   `json:"restartPolicy"`   // Automatic restart of the server when it crashes or stops answering
+	RestartSchedule RestartScheduleConfig `json:"restartSchedule"` // Scheduled restarts of the server, announced in game and on Discord
+}
+
+// RestartPolicyConfig is the automatic restart policy of a server
+type RestartPolicyConfig struct {
+	Mode        string `json:"mode"`        // "never" (default), "on-crash" or "always" (also after a stop that wasn't asked by an admin)
+	MaxRestarts int    `json:"maxRestarts"` // Maximum number of restarts in the window, 3 if 0
+	WindowMin   int    `json:"windowMin"`   // Duration of the window, 60 if 0
+	BackoffSec  int    `json:"backoffSec"`  // Delay before the first restart, doubled after each restart in the window, 30 if 0
+	GraceSec    int    `json:"graceSec"`    // Time given to a restarted server to start before it is checked again, 300 if 0
+}
+
+// RestartScheduleConfig is the restart schedule of a server
+type RestartScheduleConfig struct {
+	Cron        string `json:"cron"`        // Cron expression of the restarts, like "0 4 * * *", no scheduled restart if empty
+	WarningsSec []int  `json:"warningsSec"` // Seconds before the restart when the players are warned, 900, 300, 60 and 10 if empty
+}
+
+// BridgeTarget is a server receiving the messages of a bridge group, with its RCON parameters
+type BridgeTarget struct {
+	Config       ServerConfig
+	Server       Server
+	RconHost     string
+	RconPort     string
+	RconPassword string
+}
+
 // EmbedConfig is a struct that contains the configuration for discord embeds
 type EmbedConfig struct {
 	Title       string `json:"title"`
@@ -43,10 +136,18 @@ type DiscordChannels struct {
 	PalworldChatChannelID  string `json:"palworldChatChannelID"`
 }
 
+// DockerConfig is a struct that contains the configuration of the Docker Engine API
+type DockerConfig struct {
+	Socket          string `json:"socket"`          // Unix socket of the Docker daemon, "/var/run/docker.sock" if empty
+	DataDestination string `json:"dataDestination"` // Mount point of the server files in the containers, "/data" if empty
+}
+
 // PeriodicEventsConfig is a struct that contains the configuration for the periodic events
 type PeriodicEventsConfig struct {
-	ServersCheckEnabled   bool `json:"serversCheckEnabled"`
-	MinecraftStatsEnabled bool `json:"minecraftStatsEnabled"`
+	ServersCheckEnabled     bool `json:"serversCheckEnabled"`
+	ServersCheckIntervalSec int  `json:"serversCheckIntervalSec"` // Delay between two health checks of the servers
+	LogStaleMin             int  `json:"logStaleMin"`             // A server without log line for this long is degraded, 0 to ignore the logs
+	MinecraftStatsEnabled   bool `json:"minecraftStatsEnabled"`
 }
 
 // Type Player is a struct that represents a player in the database
@@ -60,6 +161,16 @@ type Player struct {
 	Playername    string
 }
 
+// PlayerSession is the time a player spent on a server, End is empty while the player is connected
+type PlayerSession struct {
+	ID       int
+	ServerID int
+	PlayerID int
+	Start    string
+	End      string
+	Duration int // In seconds, 0 while the session is open
+}
+
 // Type Server is a struct that represents a server in the database
 type Server struct {
 	ID          int    `json:"id"`
@@ -78,6 +189,17 @@ type Server struct {
 	Image       string `json:"image"`
 }
 
+// ServerCrash is a crash of a server, read from its crash report
+type ServerCrash struct {
+	ID            int
+	ServerID      int
+	Date          string
+	File          string // Name of the crash report file
+	Description   string
+	Exception     string
+	SuspectedMods string // Suspected mods separated by commas, empty if none
+}
+
 // Type MinecraftPlayer is a struct that represents a player in the database (very specific, i know)
 type MinecraftPlayerGameStatistics struct {
 	ID               int
@@ -102,10 +224,38 @@ type MinecraftPlayerGameStatistics struct {
 
 // Trigger is a struct that represents a trigger
 type Trigger struct {
-	Name      string            // Trigger name
-	Condition func(string) bool // Condition of the trigger
-	Action    func(string, int) // Function to execute when the condition is met
-	ServerID  int               // ID of the server
+	Name          string                       // Trigger name
+	Condition     func(string) bool            // Condition of the trigger
+	Action        func(string, int)            // Function to execute when the condition is met
+	CatchUpAction func(string, int, time.Time) // Function to execute instead of Action for old lines read after a restart, with the time written on the line, nil if the trigger only notifies
+	ServerID      int                          // ID of the server
+}
+
+// TriggerRule is a struct that represents a trigger declared in the rules file
+type TriggerRule struct {
+	Name    string              `json:"name"`    // Rule name
+	Regex   string              `json:"regex"`   // Regex with named capture groups, e.g. (?P<player>\w+)
+	Games   []string            `json:"games"`   // If set, the rule only applies to servers of these games
+	Servers []string            `json:"servers"` // If set, the rule only applies to these registered servers
+	Actions []TriggerRuleAction `json:"actions"` // Actions executed when the regex matches
+}
+
+// TriggerRuleAction is a struct that represents an action of a rule, text fields are Go templates like {{.player}}
+type TriggerRuleAction struct {
+	Type        string   `json:"type"`        // "discordEmbed", "webhook", "rcon", "db" or "logFile"
+	Bot         string   `json:"bot"`         // discordEmbed : bot name in the bots section
+	Channel     string   `json:"channel"`     // discordEmbed : channel name in discordChannels (e.g. minecraftChatChannelID) or channel ID
+	Title       string   `json:"title"`       // discordEmbed : embed title
+	Description string   `json:"description"` // discordEmbed : embed description
+	Color       string   `json:"color"`       // discordEmbed : embed color, the server color if empty
+	Webhook     string   `json:"webhook"`     // webhook : webhook name in discordWebhooks, the server webhook if empty
+	Content     string   `json:"content"`     // webhook : message content
+	Server      string   `json:"server"`      // rcon : registered server name, the server of the log if empty
+	Command     string   `json:"command"`     // rcon : command to send, the values like {{.player}} are stripped of @ " \ { } [ ] § and control characters
+	Query       string   `json:"query"`       // db : SQL query with ? placeholders
+	Args        []string `json:"args"`        // db : query arguments
+	Path        string   `json:"path"`        // logFile : path of the log file
+	Line        string   `json:"line"`        // logFile : line to write
 }
 
 type PlayerStats struct {
@@ -0,0 +1,65 @@
+package outbox
+
+// This file contains the functions queuing Discord messages, they mirror the send functions of the discord package
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+// SendDiscordMessage queues a message for a Discord channel
+func SendDiscordMessage(botName string, channelID string, message string) error {
+	return enqueueChannelPayload(botName, channelID, discord.MessagePayload(message))
+}
+
+// SendDiscordEmbed queues an embed for a Discord channel
+func SendDiscordEmbed(botName string, channelID string, title string, description string, color string) error {
+	payload, err := discord.EmbedPayload(title, description, color)
+	if err != nil {
+		return err
+	}
+	return enqueueChannelPayload(botName, channelID, payload)
+}
+
+// SendDiscordEmbedWithModel queues an embed model for a Discord channel
+func SendDiscordEmbedWithModel(botName string, channelID string, embed models.EmbedConfig) error {
+	payload, err := discord.EmbedPayloadWithModel(embed)
+	if err != nil {
+		return err
+	}
+	return enqueueChannelPayload(botName, channelID, payload)
+}
+
+// SendWebhook queues a message for a webhook of the discordWebhooks section
+func SendWebhook(webhookName string, content string) error {
+	if config.AppConfig.DiscordWebhooks[webhookName].URL == "" {
+		return fmt.Errorf("ERROR: WEBHOOK URL FOR %s NOT FOUND", webhookName)
+	}
+
+	payloadBytes, err := json.Marshal(discord.MessagePayload(content))
+	if err != nil {
+		return fmt.Errorf("ERROR MARSHALING DISCORD PAYLOAD: %v", err)
+	}
+	return Enqueue(Message{Webhook: webhookName, Payload: payloadBytes})
+}
+
+// enqueueChannelPayload checks the bot and queues a payload for a channel
+func enqueueChannelPayload(botName string, channelID string, payload map[string]interface{}) error {
+	bot := config.AppConfig.Bots[botName]
+	if !bot.Activated {
+		return nil // If the bot is not activated, we don't send the message
+	}
+	if err := discord.CheckBotParameters(bot, channelID); err != nil {
+		return err
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SERIALISING DISCORD PAYLOAD: %v", err)
+	}
+	return Enqueue(Message{Bot: botName, ChannelID: channelID, Payload: payloadBytes})
+}
@@ -0,0 +1,438 @@
+package outbox
+
+// The outbox sends the Discord messages and webhooks in the background, so a slow Discord never stalls the triggers
+// Every queued message is written in a journal, so the messages not delivered yet survive a restart
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+)
+
+const (
+	queueSize          = 500                // Maximum number of messages waiting in memory for a destination, the others wait in the journal
+	maxAttempts        = 20                 // Number of failed deliveries before a message goes to the dead letter file
+	maxRetryDelay      = 5 * time.Minute    // Maximum delay between two deliveries of a message
+	compactAfterDone   = 1000               // Number of delivered messages before the journal is rewritten
+	journalFileName    = "journal.jsonl"    // Messages queued and delivered
+	deadLetterFileName = "deadletter.jsonl" // Messages that could not be delivered
+)
+
+// Message is a message waiting to be sent to Discord
+type Message struct {
+	ID        uint64          `json:"id"`
+	Bot       string          `json:"bot,omitempty"`       // Bot name in the bots section, for channel messages
+	ChannelID string          `json:"channelID,omitempty"` // Channel the message is sent to
+	Webhook   string          `json:"webhook,omitempty"`   // Webhook name in the discordWebhooks section, for webhook messages
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Destination returns the key of the queue of the message, messages of a destination are delivered in order
+func (m Message) Destination() string {
+	if m.Webhook != "" {
+		return "webhook:" + m.Webhook
+	}
+	return "channel:" + m.ChannelID
+}
+
+// journalEntry is a line of the journal
+type journalEntry struct {
+	Op      string   `json:"op"` // "add" or "done"
+	ID      uint64   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+}
+
+var (
+	mutex        sync.Mutex
+	started      bool
+	directory    string
+	journal      *os.File
+	journalSize  int64 // Offset of the next entry of the journal
+	nextID       uint64
+	doneCount    int
+	pending      = map[uint64]int64{} // ID of the messages not delivered yet -> offset of their entry in the journal
+	queues       = map[string]chan Message{}
+	backlogs     = map[string][]uint64{} // Destination -> messages waiting for room in its queue, they are read again from the journal
+	syncRequests = make(chan struct{}, 1)
+	syncerOnce   sync.Once
+	deadLetters  sync.Mutex
+)
+
+// Start loads the messages not delivered before the last stop and starts the delivery workers
+func Start(outboxDir string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if started {
+		return nil
+	}
+	if err := os.MkdirAll(outboxDir, 0755); err != nil {
+		return fmt.Errorf("ERROR WHILE CREATING OUTBOX DIRECTORY %s: %v", outboxDir, err)
+	}
+	directory = outboxDir
+
+	// Replay the journal to find the messages not delivered yet
+	if err := loadJournal(); err != nil {
+		return err
+	}
+	if err := compactJournal(); err != nil {
+		return err
+	}
+	started = true
+	syncerOnce.Do(func() { go syncJournal() })
+
+	// Queue the messages in their creation order, the compacted journal only holds them
+	count := 0
+	err := scanJournal(func(entry journalEntry, offset int64) {
+		if entry.Op == "add" && entry.Message != nil {
+			queueMessage(*entry.Message)
+			count++
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE READING OUTBOX JOURNAL: %v", err)
+	}
+
+	if count > 0 {
+		fmt.Printf("♟ Outbox : %d messages not delivered before the last stop were queued again.\n", count)
+	}
+	return nil
+}
+
+// Enqueue adds a message to the outbox, if the outbox isn't started the message is sent right away
+func Enqueue(message Message) error {
+	mutex.Lock()
+	if !started {
+		mutex.Unlock()
+		return deliver(message)
+	}
+	defer mutex.Unlock()
+
+	nextID++
+	message.ID = nextID
+	message.CreatedAt = time.Now()
+	offset, err := writeJournal(journalEntry{Op: "add", ID: message.ID, Message: &message})
+	if err != nil {
+		return err
+	}
+	pending[message.ID] = offset
+	queueMessage(message)
+	return nil
+}
+
+// queueMessage gives a message to the worker of its destination, the mutex must be locked
+// When the queue is full, only the ID of the message stays in the backlog of its destination, it's read again from the journal when the worker makes room
+func queueMessage(message Message) {
+	destination := message.Destination()
+	queue, exists := queues[destination]
+	if !exists {
+		queue = make(chan Message, queueSize)
+		queues[destination] = queue
+		go worker(destination, queue)
+	}
+
+	if len(backlogs[destination]) > 0 {
+		backlogs[destination] = append(backlogs[destination], message.ID) // Behind the messages already waiting, to keep the order
+		return
+	}
+	select {
+	case queue <- message:
+	default:
+		fmt.Printf("♟ Outbox : queue of %s is full, the next messages wait in the journal.\n", destination)
+		backlogs[destination] = append(backlogs[destination], message.ID)
+	}
+}
+
+// refillQueue reads the messages of the backlog of a destination from the journal and moves them to its queue while it has room, the mutex must be locked
+func refillQueue(destination string, queue chan Message) {
+	backlog := backlogs[destination]
+	if len(backlog) == 0 {
+		return
+	}
+	file, err := os.Open(filepath.Join(directory, journalFileName))
+	if err != nil {
+		fmt.Println("✘ Outbox : error while opening the journal to refill the queue:", err)
+		return
+	}
+	defer file.Close()
+
+	moved := 0
+	for moved < len(backlog) && len(queue) < cap(queue) {
+		id := backlog[moved]
+		moved++
+		offset, exists := pending[id]
+		if !exists {
+			continue
+		}
+		message, err := readJournalMessage(file, offset)
+		if err != nil {
+			fmt.Printf("✘ Outbox : message %d could not be read from the journal: %v\n", id, err)
+			continue
+		}
+		queue <- message
+	}
+	if moved == len(backlog) {
+		delete(backlogs, destination)
+	} else {
+		backlogs[destination] = backlog[moved:]
+	}
+}
+
+// worker delivers the messages of a destination one by one, retrying each message until it's delivered
+func worker(destination string, queue chan Message) {
+	for message := range queue {
+		for {
+			err := deliver(message)
+			if err == nil {
+				break
+			}
+
+			message.Attempts++
+			var apiErr *discord.APIError
+			permanent := errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != 429
+			if permanent || message.Attempts >= maxAttempts {
+				writeDeadLetter(message, err.Error())
+				break
+			}
+
+			delay := time.Duration(1<<min(message.Attempts, 16)) * time.Second
+			if delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+			fmt.Printf("✘ Outbox : delivery to %s failed (attempt %d), retrying in %v: %v\n", destination, message.Attempts, delay, err)
+			time.Sleep(delay)
+		}
+
+		mutex.Lock()
+		markDone(message.ID)
+		refillQueue(destination, queue)
+		mutex.Unlock()
+	}
+}
+
+// deliver sends a message to Discord
+func deliver(message Message) error {
+	if message.Webhook != "" {
+		webhookURL := config.AppConfig.DiscordWebhooks[message.Webhook].URL
+		if webhookURL == "" {
+			return fmt.Errorf("ERROR: WEBHOOK URL FOR %s NOT FOUND", message.Webhook)
+		}
+		_, err := discord.DefaultClient.DoURL("POST", webhookURL, "", message.Payload)
+		return err
+	}
+
+	bot := config.AppConfig.Bots[message.Bot]
+	if !bot.Activated {
+		return nil // The bot was deactivated since the message was queued
+	}
+	if err := discord.CheckBotParameters(bot, message.ChannelID); err != nil {
+		return err
+	}
+	_, err := discord.DefaultClient.Do("POST", "/channels/"+message.ChannelID+"/messages", bot.BotToken, message.Payload)
+	return err
+}
+
+// markDone removes a delivered message from the journal, the mutex must be locked
+func markDone(id uint64) {
+	if !started {
+		return
+	}
+	delete(pending, id)
+	if _, err := writeJournal(journalEntry{Op: "done", ID: id}); err != nil {
+		fmt.Println("✘ Outbox : " + err.Error())
+	}
+
+	doneCount++
+	if doneCount >= compactAfterDone {
+		if err := compactJournal(); err != nil {
+			fmt.Println("✘ Outbox : " + err.Error())
+		}
+	}
+}
+
+// loadJournal reads the journal and keeps the IDs of the messages not delivered yet, the mutex must be locked
+// Their offsets are set when the journal is compacted
+func loadJournal() error {
+	err := scanJournal(func(entry journalEntry, offset int64) {
+		if entry.ID > nextID {
+			nextID = entry.ID
+		}
+		switch entry.Op {
+		case "add":
+			if entry.Message != nil {
+				pending[entry.ID] = offset
+			}
+		case "done":
+			delete(pending, entry.ID)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE READING OUTBOX JOURNAL: %v", err)
+	}
+	return nil
+}
+
+// scanJournal calls handle with each entry of the journal and its offset, skipping the lines cut by a crash
+func scanJournal(handle func(entry journalEntry, offset int64)) error {
+	file, err := os.Open(filepath.Join(directory, journalFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var offset int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err == nil {
+			handle(entry, offset)
+		}
+		offset += int64(len(line)) + 1
+	}
+	return scanner.Err()
+}
+
+// readJournalMessage reads the message of the entry at an offset of the journal
+func readJournalMessage(file *os.File, offset int64) (Message, error) {
+	line, err := bufio.NewReader(io.NewSectionReader(file, offset, 1<<62)).ReadBytes('\n')
+	if err != nil {
+		return Message{}, err
+	}
+	var entry journalEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return Message{}, err
+	}
+	if entry.Op != "add" || entry.Message == nil {
+		return Message{}, fmt.Errorf("NO MESSAGE AT OFFSET %d", offset)
+	}
+	return *entry.Message, nil
+}
+
+// compactJournal rewrites the journal with only the messages not delivered yet, the mutex must be locked
+// The entries are copied from the old journal, so the messages waiting in the backlogs are never loaded in memory all at once
+func compactJournal() error {
+	journalPath := filepath.Join(directory, journalFileName)
+	tempPath := journalPath + ".tmp"
+
+	temp, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING OUTBOX JOURNAL: %v", err)
+	}
+	writer := bufio.NewWriter(temp)
+	offsets := map[uint64]int64{}
+	var size int64
+	err = scanJournal(func(entry journalEntry, offset int64) {
+		if _, waiting := pending[entry.ID]; !waiting || entry.Op != "add" || entry.Message == nil {
+			return
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		offsets[entry.ID] = size
+		writer.Write(append(line, '\n'))
+		size += int64(len(line)) + 1
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	temp.Close()
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING OUTBOX JOURNAL: %v", err)
+	}
+	if err := os.Rename(tempPath, journalPath); err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING OUTBOX JOURNAL: %v", err)
+	}
+
+	if journal != nil {
+		journal.Close()
+	}
+	journal, err = os.OpenFile(journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE OPENING OUTBOX JOURNAL: %v", err)
+	}
+	pending = offsets
+	journalSize = size
+	doneCount = 0
+	return nil
+}
+
+// writeJournal appends an entry to the journal and returns its offset, the mutex must be locked
+// The entry is synced to the disk in the background, so writing it never waits for the disk
+func writeJournal(entry journalEntry) (int64, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, fmt.Errorf("ERROR WHILE ENCODING OUTBOX JOURNAL ENTRY: %v", err)
+	}
+	offset := journalSize
+	written, err := journal.Write(append(line, '\n'))
+	journalSize += int64(written)
+	if err != nil {
+		return 0, fmt.Errorf("ERROR WHILE WRITING OUTBOX JOURNAL: %v", err)
+	}
+
+	select {
+	case syncRequests <- struct{}{}:
+	default: // A sync is already requested, it will include this entry
+	}
+	return offset, nil
+}
+
+// syncJournal syncs the journal to the disk after entries were written, outside of the mutex
+// The entries written during a sync are synced by the next one
+func syncJournal() {
+	for range syncRequests {
+		mutex.Lock()
+		file := journal
+		mutex.Unlock()
+		if file == nil {
+			continue
+		}
+		if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			fmt.Println("✘ Outbox : error while syncing the journal:", err)
+		}
+	}
+}
+
+// writeDeadLetter appends a message that could not be delivered to the dead letter file
+func writeDeadLetter(message Message, reason string) {
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	fmt.Printf("✘ Outbox : message %d to %s moved to the dead letter file: %s\n", message.ID, message.Destination(), reason)
+	line, err := json.Marshal(struct {
+		Message
+		Reason   string    `json:"reason"`
+		FailedAt time.Time `json:"failedAt"`
+	}{message, reason, time.Now()})
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(directory, deadLetterFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Println("✘ Outbox : error while opening the dead letter file:", err)
+		return
+	}
+	defer file.Close()
+	file.Write(append(line, '\n'))
+}
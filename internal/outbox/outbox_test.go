@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+// fakeDiscord records the contents posted to the channels, in their delivery order
+type fakeDiscord struct {
+	mutex    sync.Mutex
+	contents []string
+	release  chan struct{} // Closed to let the deliveries through
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	<-f.release
+	var payload struct {
+		Content string `json:"content"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &payload)
+	f.mutex.Lock()
+	f.contents = append(f.contents, payload.Content)
+	f.mutex.Unlock()
+	w.Write([]byte("{}"))
+}
+
+func (f *fakeDiscord) delivered() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.contents...)
+}
+
+// setup points the outbox to a fake Discord and resets its state
+func setup(t *testing.T) *fakeDiscord {
+	fake := &fakeDiscord{release: make(chan struct{})}
+	server := httptest.NewServer(fake)
+	previousClient := discord.DefaultClient
+	discord.DefaultClient = discord.NewClient(server.URL)
+	config.AppConfig.Bots = map[string]models.BotConfig{"testBot": {Activated: true, BotToken: "token"}}
+
+	t.Cleanup(func() {
+		select {
+		case <-fake.release:
+		default:
+			close(fake.release)
+		}
+		server.Close()
+		discord.DefaultClient = previousClient
+		config.AppConfig.Bots = nil
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if journal != nil {
+			journal.Close()
+			journal = nil
+		}
+		started = false
+		journalSize = 0
+		nextID = 0
+		doneCount = 0
+		pending = map[uint64]int64{}
+		queues = map[string]chan Message{}
+		backlogs = map[string][]uint64{}
+	})
+	return fake
+}
+
+// waitDelivered waits until the fake Discord received count messages
+func waitDelivered(t *testing.T, fake *fakeDiscord, count int) []string {
+	deadline := time.Now().Add(10 * time.Second)
+	for len(fake.delivered()) < count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	delivered := fake.delivered()
+	if len(delivered) != count {
+		t.Fatalf("%d messages delivered, want %d", len(delivered), count)
+	}
+	return delivered
+}
+
+// TestQueueOverflow checks that the messages beyond the queue size wait in the journal, even when it's compacted, and are delivered in order
+func TestQueueOverflow(t *testing.T) {
+	fake := setup(t)
+	dir := t.TempDir()
+	if err := Start(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	count := queueSize + 20
+	for i := 0; i < count; i++ {
+		if err := SendDiscordMessage("testBot", "1", strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mutex.Lock()
+	waiting := len(backlogs["channel:1"])
+	err := compactJournal()
+	mutex.Unlock()
+	if waiting < count-queueSize-1 {
+		t.Errorf("%d messages wait in the journal, want at least %d", waiting, count-queueSize-1)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(fake.release)
+
+	delivered := waitDelivered(t, fake, count)
+	for i, content := range delivered {
+		if want := strconv.Itoa(i); content != want {
+			t.Fatalf("message %d = %q, want %q", i, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, deadLetterFileName)); !os.IsNotExist(err) {
+		t.Errorf("messages moved to the dead letter file: %v", err)
+	}
+}
+
+// TestJournalReplay checks that the messages not delivered before a stop are delivered in order after the next start
+func TestJournalReplay(t *testing.T) {
+	fake := setup(t)
+	dir := t.TempDir()
+
+	var journalContent []byte
+	for _, entry := range []journalEntry{
+		{Op: "add", ID: 1, Message: &Message{ID: 1, Bot: "testBot", ChannelID: "1", Payload: json.RawMessage(`{"content":"first"}`)}},
+		{Op: "add", ID: 2, Message: &Message{ID: 2, Bot: "testBot", ChannelID: "1", Payload: json.RawMessage(`{"content":"second"}`)}},
+		{Op: "done", ID: 1},
+		{Op: "add", ID: 3, Message: &Message{ID: 3, Bot: "testBot", ChannelID: "1", Payload: json.RawMessage(`{"content":"third"}`)}},
+	} {
+		line, _ := json.Marshal(entry)
+		journalContent = append(append(journalContent, line...), '\n')
+	}
+	journalContent = append(journalContent, `{"op":"add","id":4,"mess`...) // Cut by a crash
+	if err := os.WriteFile(filepath.Join(dir, journalFileName), journalContent, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Start(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendDiscordMessage("testBot", "1", "fourth"); err != nil {
+		t.Fatal(err)
+	}
+	close(fake.release)
+
+	delivered := waitDelivered(t, fake, 3)
+	if strings.Join(delivered, ",") != "second,third,fourth" {
+		t.Errorf("delivered = %v", delivered)
+	}
+
+	// The new message didn't reuse an ID of the journal
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		remaining := len(pending)
+		mutex.Unlock()
+		if remaining == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(pending) != 0 || nextID != 4 {
+		t.Errorf("pending = %v, nextID = %d", pending, nextID)
+	}
+}
@@ -0,0 +1,272 @@
+package recovery
+
+// The recovery restarts the servers following their restart policy
+// A server is restarted when it crashes, when its container dies or when its health check fails
+// The restarts are limited in a window, once the limit is reached the server is left to the admins
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/lifecycle"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+)
+
+// Restart policies
+const (
+	PolicyNever   = "never"
+	PolicyOnCrash = "on-crash"
+	PolicyAlways  = "always"
+)
+
+// Causes of a failure
+const (
+	CauseCrash = "crash" // The server wrote a crash line
+	CauseDown  = "down"  // The container is dead or the server doesn't answer the health check
+)
+
+const maxBackoff = 10 * time.Minute
+
+// serverState is the recovery state of a server
+type serverState struct {
+	restarts    []time.Time // Automatic restarts in the window
+	restarting  bool        // A restart is waiting for its backoff or running
+	cleanStop   bool        // The server wrote its stopping line, and didn't start again since
+	exhausted   bool        // The restart limit was reached, the server isn't restarted anymore until it starts again
+	lastRestart time.Time
+}
+
+var (
+	states      = map[int]*serverState{}
+	statesMutex sync.Mutex
+)
+
+// The restart and the name lookup are variables, so the tests can replace them
+var (
+	recoverServer = lifecycle.RecoverServer
+	getServerName = serverName
+)
+
+// getState returns the state of a server, statesMutex must be locked
+func getState(serverID int) *serverState {
+	state, exists := states[serverID]
+	if !exists {
+		state = &serverState{}
+		states[serverID] = state
+	}
+	return state
+}
+
+// ServerStarted clears the clean stop and the exhausted limit of a server, its restarts in the window are kept
+func ServerStarted(serverID int) {
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+
+	state := getState(serverID)
+	state.cleanStop = false
+	if state.exhausted {
+		state.exhausted = false
+		fmt.Printf("♟ Server %d started again, its automatic restarts are enabled again.\n", serverID)
+	}
+}
+
+// ServerStopped marks a server as cleanly stopped, a server stopped this way is only restarted with the "always" policy
+func ServerStopped(serverID int) {
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+	getState(serverID).cleanStop = true
+}
+
+// IsExhausted returns true if a server reached its restart limit
+func IsExhausted(serverID int) bool {
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+	state, exists := states[serverID]
+	return exists && state.exhausted
+}
+
+// ServerCrashed restarts a server that wrote a crash line, if its policy allows it
+func ServerCrashed(serverID int) {
+	handleFailure(serverID, CauseCrash, "le serveur a crash")
+}
+
+// ServerDown restarts a server whose container is dead or that doesn't answer its health check, if its policy allows it
+// The health check calls it at each check while the server is down, the restarts running or too recent are ignored
+func ServerDown(serverID int, detail string) {
+	handleFailure(serverID, CauseDown, detail)
+}
+
+// handleFailure decides if a server must be restarted, and starts its restart after the backoff
+func handleFailure(serverID int, cause string, detail string) {
+	server, registered := db.GetServerConfigById(serverID)
+	if !registered {
+		return
+	}
+	policy := withDefaults(server.RestartPolicy)
+	if policy.Mode != PolicyOnCrash && policy.Mode != PolicyAlways {
+		return
+	}
+
+	statesMutex.Lock()
+	state := getState(serverID)
+	now := time.Now()
+	switch {
+	case state.restarting, state.exhausted:
+		statesMutex.Unlock()
+		return
+	case cause == CauseDown && now.Sub(state.lastRestart) < time.Duration(policy.GraceSec)*time.Second:
+		statesMutex.Unlock()
+		return // The restarted server is still starting, a crash line is the only failure read during this time
+	case cause == CauseDown && state.cleanStop && policy.Mode != PolicyAlways:
+		statesMutex.Unlock()
+		return
+	}
+	if lifecycle.StoppedOnPurpose(serverID) {
+		statesMutex.Unlock()
+		return // Stopped by an admin
+	}
+
+	state.restarts = inWindow(state.restarts, now, time.Duration(policy.WindowMin)*time.Minute)
+	if len(state.restarts) >= policy.MaxRestarts {
+		state.exhausted = true
+		statesMutex.Unlock()
+		notifyExhausted(serverID, policy, detail)
+		return
+	}
+	backoff := backoffDelay(policy, len(state.restarts))
+	state.restarting = true
+	statesMutex.Unlock()
+
+	fmt.Printf("♟ Server %d failed (%s: %s), restarting it in %v.\n", serverID, cause, detail, backoff)
+	go restartAfter(serverID, backoff, cause, detail)
+}
+
+// restartAfter restarts a server after its backoff, unless an admin stopped it meanwhile
+// The restart stops what is left of the server first, like a hanging process or a container restarted by Docker
+// A failed restart counts in the window, and the failure is handled again so the next restart or the limit follows
+func restartAfter(serverID int, backoff time.Duration, cause string, detail string) {
+	time.Sleep(backoff)
+
+	statesMutex.Lock()
+	state := getState(serverID)
+	stillDown := !lifecycle.StoppedOnPurpose(serverID)
+	if stillDown {
+		state.restarts = append(state.restarts, time.Now())
+		state.lastRestart = time.Now()
+	}
+	attempt := len(state.restarts)
+	statesMutex.Unlock()
+
+	var err error
+	if stillDown {
+		err = recoverServer(serverID)
+	}
+
+	statesMutex.Lock()
+	state.restarting = false
+	if err != nil {
+		state.lastRestart = time.Time{} // The server didn't start, there's no start to give a grace to
+	}
+	statesMutex.Unlock()
+
+	if !stillDown {
+		fmt.Printf("♟ Server %d was stopped by an admin, it isn't restarted.\n", serverID)
+		return
+	}
+	notifyRestart(serverID, attempt, detail, err)
+	if err != nil {
+		handleFailure(serverID, cause, detail)
+	}
+}
+
+// withDefaults returns a restart policy with the defaults of its unset values
+func withDefaults(policy models.RestartPolicyConfig) models.RestartPolicyConfig {
+	if policy.Mode == "" {
+		policy.Mode = PolicyNever
+	}
+	if policy.MaxRestarts <= 0 {
+		policy.MaxRestarts = 3
+	}
+	if policy.WindowMin <= 0 {
+		policy.WindowMin = 60
+	}
+	if policy.BackoffSec <= 0 {
+		policy.BackoffSec = 30
+	}
+	if policy.GraceSec <= 0 {
+		policy.GraceSec = 300
+	}
+	return policy
+}
+
+// inWindow returns the restarts that happened in the window
+func inWindow(restarts []time.Time, now time.Time, window time.Duration) []time.Time {
+	var kept []time.Time
+	for _, restart := range restarts {
+		if now.Sub(restart) < window {
+			kept = append(kept, restart)
+		}
+	}
+	return kept
+}
+
+// backoffDelay returns the delay before a restart, doubled for each restart already done in the window
+func backoffDelay(policy models.RestartPolicyConfig, restarts int) time.Duration {
+	delay := time.Duration(policy.BackoffSec) * time.Second
+	for i := 0; i < restarts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// serverName returns the name of a server for the notices
+func serverName(serverID int) string {
+	if serv, err := db.GetServerById(serverID); err == nil {
+		return serv.Nom
+	}
+	return fmt.Sprintf("%d", serverID)
+}
+
+// notifyRestart posts the result of an automatic restart in the bot admin channel
+func notifyRestart(serverID int, attempt int, detail string, err error) {
+	name := getServerName(serverID)
+	title := "🔄 " + name + " a été redémarré automatiquement"
+	description := fmt.Sprintf("Cause : %s\nRedémarrage n°%d de la fenêtre.", detail, attempt)
+	color := "#ff8c00"
+	if err != nil {
+		fmt.Println("✘ Error while restarting "+name+":", err)
+		title = "✘ Le redémarrage automatique de " + name + " a échoué"
+		description += "\nErreur : " + err.Error()
+		color = "#ff0000"
+	} else {
+		fmt.Printf("✔ Server %s restarted by its restart policy.\n", name)
+	}
+
+	if err := outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.BotAdminChannelID, title, description, color); err != nil {
+		fmt.Println("✘ Error while sending the restart notice of "+name+":", err)
+	}
+}
+
+// notifyExhausted pings the admins when a server reached its restart limit
+func notifyExhausted(serverID int, policy models.RestartPolicyConfig, detail string) {
+	name := getServerName(serverID)
+	fmt.Printf("✘ Server %s reached its limit of %d restarts in %d minutes, it isn't restarted anymore.\n", name, policy.MaxRestarts, policy.WindowMin)
+
+	var mentions []string
+	for _, role := range config.AppConfig.Interactions.AdminRoles {
+		mentions = append(mentions, "<@&"+role+">")
+	}
+	message := fmt.Sprintf("⚠️ **%s** a été redémarré %d fois en %d minutes et ne répond toujours pas (%s).\nIl est marqué comme dégradé et ne sera plus redémarré automatiquement jusqu'à son prochain démarrage.", name, policy.MaxRestarts, policy.WindowMin, detail)
+	if len(mentions) > 0 {
+		message = strings.Join(mentions, " ") + " " + message
+	}
+
+	if err := outbox.SendDiscordMessage("mineotterBot", config.AppConfig.DiscordChannels.BotAdminChannelID, message); err != nil {
+		fmt.Println("✘ Error while sending the restart limit notice of "+name+":", err)
+	}
+}
@@ -0,0 +1,78 @@
+package recovery
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/lifecycle"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	policy := withDefaults(models.RestartPolicyConfig{BackoffSec: 30})
+	tests := map[int]time.Duration{
+		0:  30 * time.Second,
+		2:  2 * time.Minute,
+		10: maxBackoff,
+	}
+	for restarts, want := range tests {
+		if got := backoffDelay(policy, restarts); got != want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", restarts, got, want)
+		}
+	}
+}
+
+// TestFailedStart checks that restarts whose start fails count toward the limit, until the server is marked degraded
+func TestFailedStart(t *testing.T) {
+	config.AppConfig.StoppedServersFile = filepath.Join(t.TempDir(), "stopped_servers.json")
+	config.AppConfig.Servers = []models.ServerConfig{{
+		Name:          "test",
+		ServerID:      7,
+		RestartPolicy: models.RestartPolicyConfig{Mode: PolicyOnCrash, MaxRestarts: 2, BackoffSec: 1},
+	}}
+	var attempts atomic.Int32
+	recoverServer = func(serverID int) error {
+		attempts.Add(1)
+		return errors.New("container exited")
+	}
+	var notices atomic.Int32
+	getServerName = func(serverID int) string {
+		notices.Add(1)
+		return "test"
+	}
+	t.Cleanup(func() {
+		recoverServer = lifecycle.RecoverServer
+		getServerName = serverName
+		config.AppConfig.Servers = nil
+		statesMutex.Lock()
+		delete(states, 7)
+		statesMutex.Unlock()
+	})
+
+	ServerCrashed(7)
+	deadline := time.Now().Add(10 * time.Second)
+	for notices.Load() < 3 && time.Now().Before(deadline) { // Two failed restart notices, then the limit notice
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !IsExhausted(7) {
+		t.Fatalf("server not marked degraded after %d failed restarts", attempts.Load())
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("restarts = %d, want 2", got)
+	}
+	if lifecycle.StoppedOnPurpose(7) {
+		t.Error("failed restart marked the server as stopped on purpose")
+	}
+
+	// A degraded server isn't restarted anymore
+	ServerCrashed(7)
+	time.Sleep(100 * time.Millisecond)
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("restarts of a degraded server = %d, want 2", got)
+	}
+}
@@ -0,0 +1,268 @@
+package roster
+
+// The roster keeps the players connected to each server
+// It's fed by the join, leave, start and stop lines of the logs, and checked regularly against the servers themselves
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+// ServerRoster is the state of a server
+type ServerRoster struct {
+	ServerID     int
+	Online       bool      // The server answered or started since it was last seen stopped
+	Players      []string  // Names of the connected players, sorted
+	OnlineSince  time.Time // Time the server was seen starting, zero when offline
+	UpdatedAt    time.Time // Time of the last change
+	ReconciledAt time.Time // Time the list was last read from the server
+}
+
+// serverState is the state of a server, with the time each player joined
+type serverState struct {
+	online       bool
+	onlineSince  time.Time
+	players      map[string]time.Time
+	updatedAt    time.Time
+	reconciledAt time.Time
+}
+
+var (
+	servers = map[int]*serverState{}
+	mutex   sync.RWMutex
+)
+
+// getState returns the state of a server, creating it if needed, the mutex must be locked
+func getState(serverID int) *serverState {
+	state, exists := servers[serverID]
+	if !exists {
+		state = &serverState{players: map[string]time.Time{}}
+		servers[serverID] = state
+	}
+	return state
+}
+
+// PlayerJoined adds a player to a server
+func PlayerJoined(serverID int, playerName string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := getState(serverID)
+	if _, exists := state.players[playerName]; !exists {
+		state.players[playerName] = time.Now()
+	}
+	state.setOnline(true)
+	state.updatedAt = time.Now()
+}
+
+// PlayerLeft removes a player from a server
+func PlayerLeft(serverID int, playerName string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := getState(serverID)
+	delete(state.players, playerName)
+	state.updatedAt = time.Now()
+}
+
+// ServerStarted marks a server as online, without players
+func ServerStarted(serverID int) {
+	setServerState(serverID, true)
+}
+
+// ServerStopped marks a server as offline and removes its players
+func ServerStopped(serverID int) {
+	setServerState(serverID, false)
+}
+
+// setServerState changes the online state of a server and removes its players
+func setServerState(serverID int, online bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := getState(serverID)
+	state.online = false // A start line always resets the start time
+	state.setOnline(online)
+	state.players = map[string]time.Time{}
+	state.updatedAt = time.Now()
+}
+
+// Get returns the state of a server
+func Get(serverID int) ServerRoster {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	state, exists := servers[serverID]
+	if !exists {
+		return ServerRoster{ServerID: serverID}
+	}
+	return state.roster(serverID)
+}
+
+// GetAll returns the state of every known server, sorted by server ID
+func GetAll() []ServerRoster {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	var rosters []ServerRoster
+	for serverID, state := range servers {
+		rosters = append(rosters, state.roster(serverID))
+	}
+	sort.Slice(rosters, func(i, j int) bool { return rosters[i].ServerID < rosters[j].ServerID })
+	return rosters
+}
+
+// Count returns the number of players connected to a server
+func Count(serverID int) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	state, exists := servers[serverID]
+	if !exists {
+		return 0
+	}
+	return len(state.players)
+}
+
+// setOnline changes the online state of a server, keeping the time it started, the mutex must be locked
+func (s *serverState) setOnline(online bool) {
+	if online && !s.online {
+		s.onlineSince = time.Now()
+	} else if !online {
+		s.onlineSince = time.Time{}
+	}
+	s.online = online
+}
+
+// roster copies the state of a server, the mutex must be locked
+func (s *serverState) roster(serverID int) ServerRoster {
+	players := make([]string, 0, len(s.players))
+	for name := range s.players {
+		players = append(players, name)
+	}
+	sort.Strings(players)
+	return ServerRoster{
+		ServerID:     serverID,
+		Online:       s.online,
+		OnlineSince:  s.onlineSince,
+		Players:      players,
+		UpdatedAt:    s.updatedAt,
+		ReconciledAt: s.reconciledAt,
+	}
+}
+
+// StartReconciliation reads the player list of every registered server now, then at each interval
+func StartReconciliation(interval time.Duration) {
+	for {
+		Reconcile()
+		time.Sleep(interval)
+	}
+}
+
+// Reconcile replaces the players of each registered server with the list read from the server
+// The differences with the players known from the logs are reported, they mean a line was missed
+// The disabled servers are skipped, they are meant to be off
+func Reconcile() {
+	for _, server := range config.AppConfig.Servers {
+		if server.Disabled {
+			continue
+		}
+		serverID := db.ResolveServerID(server)
+		if serverID <= 0 {
+			continue
+		}
+		game, err := db.GetServerGameById(serverID)
+		if err != nil {
+			continue
+		}
+
+		var players []string
+		switch game {
+		case "Minecraft":
+			host, port, password := db.GetRconAddress(server)
+			var response string
+			response, err = services.SendRconToMinecraftServer(host, port, password, "list")
+			if err == nil {
+				players, err = services.ParseMinecraftPlayerList(response)
+			}
+		case "Palworld":
+			var palworldPlayers []services.PalworldPlayer
+			palworldPlayers, err = db.GetPalworldClient(server).Players()
+			for _, player := range palworldPlayers {
+				players = append(players, player.Name)
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			// The server doesn't answer, it may have crashed without writing it in its logs
+			markUnreachable(serverID, server.Name)
+			continue
+		}
+		applyServerList(serverID, server.Name, players)
+	}
+}
+
+// applyServerList replaces the players of a server with the list read from it
+func applyServerList(serverID int, serverName string, players []string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := getState(serverID)
+	var missingJoins, missingLeaves []string
+	for _, name := range players {
+		if _, exists := state.players[name]; !exists {
+			missingJoins = append(missingJoins, name)
+		}
+	}
+	for name := range state.players {
+		if !slices.Contains(players, name) {
+			missingLeaves = append(missingLeaves, name)
+		}
+	}
+
+	if state.online && (len(missingJoins) > 0 || len(missingLeaves) > 0) {
+		sort.Strings(missingLeaves)
+		fmt.Printf("♟ Roster of %s differs from the server : not seen joining [%s], not seen leaving [%s].\n",
+			serverName, strings.Join(missingJoins, ", "), strings.Join(missingLeaves, ", "))
+	}
+
+	newPlayers := map[string]time.Time{}
+	for _, name := range players {
+		joinedAt, exists := state.players[name]
+		if !exists {
+			joinedAt = time.Now()
+		}
+		newPlayers[name] = joinedAt
+	}
+	if len(missingJoins) > 0 || len(missingLeaves) > 0 || !state.online {
+		state.updatedAt = time.Now()
+	}
+	state.players = newPlayers
+	state.setOnline(true)
+	state.reconciledAt = time.Now()
+}
+
+// markUnreachable marks a server that doesn't answer as offline
+func markUnreachable(serverID int, serverName string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := getState(serverID)
+	if state.online {
+		fmt.Printf("♟ Roster of %s cleared : the server doesn't answer (%d players were connected).\n", serverName, len(state.players))
+		state.setOnline(false)
+		state.players = map[string]time.Time{}
+		state.updatedAt = time.Now()
+	}
+	state.reconciledAt = time.Now()
+}
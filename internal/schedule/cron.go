@@ -0,0 +1,162 @@
+package schedule
+
+// This file contains the cron expressions of the restart schedules
+// The expressions have the five standard fields : minute, hour, day of month, month and day of week
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression, each field is the set of the values it matches
+type Cron struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+	anyMonthDay bool // The day of month is "*"
+	anyWeekDay  bool // The day of week is "*"
+}
+
+// cronField is the range of the values of a field
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are Sunday
+}
+
+// Shortcuts accepted instead of the five fields
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseCron parses a cron expression like "0 4 * * *" or "30 5 * * 1-5"
+func ParseCron(expression string) (*Cron, error) {
+	expression = strings.TrimSpace(expression)
+	if shortcut, exists := cronShortcuts[expression]; exists {
+		expression = shortcut
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("ERROR: CRON EXPRESSION %q MUST HAVE %d FIELDS", expression, len(cronFields))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("ERROR IN CRON EXPRESSION %q: %v", expression, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday is 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &Cron{
+		minutes:     sets[0],
+		hours:       sets[1],
+		daysOfMonth: sets[2],
+		months:      sets[3],
+		daysOfWeek:  sets[4],
+		anyMonthDay: fields[2] == "*",
+		anyWeekDay:  fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a field made of comma separated "*", values, ranges and steps like "*/15" or "1-5/2"
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("INVALID STEP %q IN %s", part, bounds.name)
+			}
+		}
+
+		low, high := bounds.min, bounds.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("INVALID VALUE %q IN %s", part, bounds.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("INVALID VALUE %q IN %s", part, bounds.name)
+				}
+			} else if hasStep {
+				high = bounds.max // "5/15" is "5-max/15"
+			}
+		}
+		if low < bounds.min || high > bounds.max || low > high {
+			return 0, fmt.Errorf("VALUE %q OUT OF RANGE IN %s (%d-%d)", part, bounds.name, bounds.min, bounds.max)
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time matching the expression strictly after a time, in the location of the time
+// It returns the zero time if nothing matches in the next five years, like "0 0 31 2 *"
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay returns true if the day of a time matches
+// Like in cron, when both day fields are set, a day matching one of them is enough
+func (c *Cron) matchesDay(t time.Time) bool {
+	monthDay := c.daysOfMonth&(1<<t.Day()) != 0
+	weekDay := c.daysOfWeek&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.anyMonthDay && c.anyWeekDay:
+		return true
+	case c.anyMonthDay:
+		return weekDay
+	case c.anyWeekDay:
+		return monthDay
+	default:
+		return monthDay || weekDay
+	}
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		paris = time.UTC
+	}
+	from := time.Date(2025, 1, 12, 18, 3, 44, 0, paris) // A Sunday
+
+	tests := []struct {
+		expression string
+		want       time.Time
+	}{
+		{"0 4 * * *", time.Date(2025, 1, 13, 4, 0, 0, 0, paris)},
+		{"*/15 * * * *", time.Date(2025, 1, 12, 18, 15, 0, 0, paris)},
+		{"30 5 * * 1-5", time.Date(2025, 1, 13, 5, 30, 0, 0, paris)},
+		{"0 4 * * 0", time.Date(2025, 1, 19, 4, 0, 0, 0, paris)},
+		{"0 4 * * 7", time.Date(2025, 1, 19, 4, 0, 0, 0, paris)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, paris)},
+		{"0 0 15 * 1", time.Date(2025, 1, 13, 0, 0, 0, 0, paris)}, // Day of month or day of week
+		{"0 3,15 * * *", time.Date(2025, 1, 13, 3, 0, 0, 0, paris)},
+		{"@daily", time.Date(2025, 1, 13, 0, 0, 0, 0, paris)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, paris)},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.expression)
+		if err != nil {
+			t.Errorf("ParseCron(%q) = %v", test.expression, err)
+			continue
+		}
+		if got := cron.Next(from); !got.Equal(test.want) {
+			t.Errorf("Next(%q) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestCronNextIsStrictlyAfter(t *testing.T) {
+	cron, _ := ParseCron("0 4 * * *")
+	at := time.Date(2025, 1, 13, 4, 0, 0, 0, time.UTC)
+	if got := cron.Next(at); !got.Equal(at.AddDate(0, 0, 1)) {
+		t.Errorf("Next() at an occurrence = %v", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{"", "0 4 * *", "60 4 * * *", "0 24 * * *", "0 4 0 * *", "0 4 * 13 *", "0 4 * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("ParseCron(%q) returned no error", expression)
+		}
+	}
+	if cron, _ := ParseCron("0 0 31 2 *"); !cron.Next(time.Now()).IsZero() {
+		t.Error("Next() of a date that never happens isn't the zero time")
+	}
+}
@@ -0,0 +1,512 @@
+package schedule
+
+// The schedule restarts the servers at the times of their cron expression
+// The players are warned in game and on Discord before the restart, and the restart is confirmed when the server started again
+// The pending restarts are kept in the schedules file, so the CLI can postpone or cancel them while the daemon runs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/console"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/lifecycle"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+const (
+	missedAfter   = time.Minute      // A restart that should have happened longer ago, like while the daemon was stopped, is skipped
+	startTimeout  = 15 * time.Minute // Time given to a server to write its started line, modded servers are slow to start
+	warningPrefix = "[Redémarrage] "
+)
+
+// Seconds before the restart when the players are warned, if the server has none set
+var defaultWarnings = []int{900, 300, 60, 10}
+
+// Lines written by the servers once they started
+var startedLineRegexes = map[string]*regexp.Regexp{
+	"Minecraft": regexp.MustCompile(`Done\s*\(.*?\)!`),
+	"Palworld":  regexp.MustCompile(`Running Palworld dedicated server on :\d+`),
+}
+
+// PendingRestart is the next scheduled restart of a server
+type PendingRestart struct {
+	ServerID   int       `json:"serverID"`
+	Occurrence time.Time `json:"occurrence"` // Time given by the cron expression
+	RestartAt  time.Time `json:"restartAt"`  // Occurrence and the postponements
+	Cancelled  bool      `json:"cancelled"`
+}
+
+// countdown is what the daemon knows of the pending restart of a server
+type countdown struct {
+	seen       PendingRestart // Pending restart at the last tick, to announce the postponements and the cancellations
+	lastWarned int            // Smallest warning sent for the restart time, in seconds
+	running    bool
+}
+
+var (
+	countdowns      = map[int]*countdown{}
+	countdownsMutex sync.Mutex
+	fileMutex       sync.Mutex
+)
+
+// Start checks the pending restarts each minute, and at the times of their warnings and of the restarts
+// The servers are resolved once, a server whose ID changes is picked up when the daemon restarts
+func Start() error {
+	servers := scheduledServers()
+	if len(servers) == 0 {
+		fmt.Println("♟ No server has a restart schedule.")
+		return nil
+	}
+	for serverID, server := range servers {
+		if _, err := ParseCron(server.RestartSchedule.Cron); err != nil {
+			return fmt.Errorf("ERROR IN RESTART SCHEDULE OF %s: %v", server.Name, err)
+		}
+		fmt.Printf("✔ Restart schedule of %s (%d) : %s\n", server.Name, serverID, server.RestartSchedule.Cron)
+	}
+
+	for {
+		next := tick(servers, time.Now())
+		time.Sleep(time.Until(next))
+	}
+}
+
+// scheduledServers returns the registered servers with a restart schedule, by server ID
+func scheduledServers() map[int]models.ServerConfig {
+	servers := map[int]models.ServerConfig{}
+	for _, server := range config.AppConfig.Servers {
+		if server.RestartSchedule.Cron == "" {
+			continue
+		}
+		if serverID := db.ResolveServerID(server); serverID > 0 {
+			servers[serverID] = server
+		}
+	}
+	return servers
+}
+
+// tick refreshes the pending restarts, sends the warnings and starts the restarts that are due
+// It returns the time of the next tick, the next minute at the latest so the changes made with the CLI are seen
+func tick(servers map[int]models.ServerConfig, now time.Time) time.Time {
+	next := now.Truncate(time.Minute).Add(time.Minute)
+	pending, err := updateState(func(state map[string]PendingRestart) bool {
+		changed := false
+		for serverID, server := range servers {
+			if refreshPending(state, serverID, server, now) {
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		fmt.Println("✘ Error while reading the scheduled restarts:", err)
+		return next
+	}
+
+	for serverID, server := range servers {
+		restart, exists := pending[strconv.Itoa(serverID)]
+		if !exists {
+			continue
+		}
+		handleCountdown(server, restart, now)
+		if event := nextEvent(server, restart, now); !event.IsZero() && event.Before(next) {
+			next = event
+		}
+	}
+	return next
+}
+
+// nextEvent returns the time of the next warning or of the restart, zero if the restart is cancelled or already due
+func nextEvent(server models.ServerConfig, restart PendingRestart, now time.Time) time.Time {
+	if restart.Cancelled || !restart.RestartAt.After(now) {
+		return time.Time{}
+	}
+	event := restart.RestartAt
+	for _, seconds := range warnings(server) {
+		if warning := restart.RestartAt.Add(-time.Duration(seconds) * time.Second); warning.After(now) && warning.Before(event) {
+			event = warning
+		}
+	}
+	return event
+}
+
+// refreshPending replaces the pending restart of a server once it is over, missed or no longer in its schedule
+// It returns true if the state changed
+func refreshPending(state map[string]PendingRestart, serverID int, server models.ServerConfig, now time.Time) bool {
+	cron, err := ParseCron(server.RestartSchedule.Cron)
+	if err != nil {
+		return false
+	}
+	key := strconv.Itoa(serverID)
+	restart, exists := state[key]
+
+	if exists {
+		stillScheduled := cron.Next(restart.Occurrence.Add(-time.Minute)).Equal(restart.Occurrence)
+		over := now.Sub(restart.RestartAt) > missedAfter || (restart.Cancelled && !now.Before(restart.RestartAt))
+		if stillScheduled && !over {
+			return false
+		}
+	}
+
+	after := now
+	if exists && restart.Occurrence.After(after) {
+		after = restart.Occurrence
+	}
+	next := cron.Next(after)
+	if next.IsZero() {
+		return false
+	}
+	state[key] = PendingRestart{ServerID: serverID, Occurrence: next, RestartAt: next}
+	return true
+}
+
+// handleCountdown announces the changes of a pending restart, sends its warnings, and starts it when it is due
+func handleCountdown(server models.ServerConfig, restart PendingRestart, now time.Time) {
+	countdownsMutex.Lock()
+	defer countdownsMutex.Unlock()
+
+	current, exists := countdowns[restart.ServerID]
+	if !exists {
+		current = &countdown{seen: restart, lastWarned: maxWarning(server) + 1}
+		countdowns[restart.ServerID] = current
+	}
+	if current.running {
+		return
+	}
+
+	// Postponements and cancellations can come from the CLI, they are announced here once the players were warned
+	if current.seen.Occurrence.Equal(restart.Occurrence) {
+		warned := current.lastWarned <= maxWarning(server)
+		switch {
+		case restart.Cancelled && !current.seen.Cancelled:
+			fmt.Printf("♟ Scheduled restart of %s cancelled.\n", server.Name)
+			if warned {
+				announce(server, restart.ServerID, "Le redémarrage prévu à "+restart.RestartAt.Format("15:04")+" est annulé.")
+			}
+		case !restart.RestartAt.Equal(current.seen.RestartAt):
+			fmt.Printf("♟ Scheduled restart of %s postponed to %s.\n", server.Name, restart.RestartAt.Format("02/01/2006 15:04:05"))
+			if warned {
+				announce(server, restart.ServerID, "Le redémarrage est reporté à "+restart.RestartAt.Format("15:04")+".")
+			}
+		}
+	}
+	if !restart.RestartAt.Equal(current.seen.RestartAt) || !restart.Occurrence.Equal(current.seen.Occurrence) {
+		current.lastWarned = maxWarning(server) + 1
+	}
+	current.seen = restart
+	if restart.Cancelled {
+		return
+	}
+
+	remaining := restart.RestartAt.Sub(now)
+	if remaining <= 0 {
+		current.running = true
+		go runRestart(server, restart)
+		return
+	}
+
+	// Only the nearest warning is sent, so a daemon started during a countdown doesn't send them all
+	warning := 0
+	for _, seconds := range warnings(server) {
+		if remaining <= time.Duration(seconds)*time.Second && seconds < current.lastWarned && (warning == 0 || seconds < warning) {
+			warning = seconds
+		}
+	}
+	if warning > 0 {
+		current.lastWarned = warning
+		announce(server, restart.ServerID, "Le serveur redémarre dans "+formatRemaining(remaining)+".")
+	}
+}
+
+// runRestart stops the server, starts it again and waits for its started line
+// The world is saved by the stop of the lifecycle, with save-all for Minecraft and the save of the API for Palworld
+func runRestart(server models.ServerConfig, restart PendingRestart) {
+	serverID := restart.ServerID
+	defer func() {
+		finishRestart(restart)
+		countdownsMutex.Lock()
+		countdowns[serverID].running = false
+		countdownsMutex.Unlock()
+	}()
+
+	if lifecycle.StoppedOnPurpose(serverID) {
+		fmt.Printf("♟ Server %s was stopped by an admin, its scheduled restart is skipped.\n", server.Name)
+		return
+	}
+	announce(server, serverID, "Le serveur redémarre maintenant.")
+	fmt.Printf("♟ Scheduled restart of %s.\n", server.Name)
+
+	if err := lifecycle.StopServer(serverID); err != nil {
+		notifyFailure(server, err)
+		return
+	}
+
+	serv, _ := db.GetServerById(serverID)
+	var waiter *console.LogWaiter
+	if regex, exists := startedLineRegexes[serv.Jeu]; exists {
+		var err error
+		if waiter, err = console.ExpectLogLine(server, regex); err != nil {
+			fmt.Println("✘ The started line of "+server.Name+" can't be waited for:", err)
+		}
+	}
+
+	if err := lifecycle.StartServer(serverID); err != nil {
+		if waiter != nil {
+			waiter.Close()
+		}
+		notifyFailure(server, err)
+		return
+	}
+	if waiter == nil {
+		return
+	}
+
+	if _, found := waiter.Wait(startTimeout); !found {
+		notifyFailure(server, fmt.Errorf("ERROR: SERVER %s DIDN'T START WITHIN %v", server.Name, startTimeout))
+		return
+	}
+	fmt.Printf("✔ Scheduled restart of %s done.\n", server.Name)
+	err := outbox.SendDiscordEmbed("mineotterBot", chatChannelID(serv), "🔄 "+serv.Nom+" a redémarré", "Le redémarrage programmé est terminé, vous pouvez vous reconnecter !", serv.EmbedColor)
+	if err != nil {
+		fmt.Println("✘ Error while sending the restart confirmation of "+server.Name+":", err)
+	}
+}
+
+// finishRestart replaces a pending restart that is over by the next one, unless it was already replaced
+func finishRestart(restart PendingRestart) {
+	_, err := updateState(func(state map[string]PendingRestart) bool {
+		key := strconv.Itoa(restart.ServerID)
+		if state[key].Occurrence.After(restart.Occurrence) {
+			return false
+		}
+		delete(state, key) // The next tick schedules the next restart
+		return true
+	})
+	if err != nil {
+		fmt.Println("✘ Error while writing the scheduled restarts:", err)
+	}
+}
+
+// notifyFailure posts a failed scheduled restart in the bot admin channel
+func notifyFailure(server models.ServerConfig, err error) {
+	fmt.Println("✘ Error during the scheduled restart of "+server.Name+":", err)
+	sendErr := outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.BotAdminChannelID, "✘ Le redémarrage programmé de "+server.Name+" a échoué", err.Error(), "#ff0000")
+	if sendErr != nil {
+		fmt.Println("✘ Error while sending the restart failure of "+server.Name+":", sendErr)
+	}
+}
+
+// announce sends a message about the restart in game and in the chat channel of the server
+func announce(server models.ServerConfig, serverID int, message string) {
+	serv, err := db.GetServerById(serverID)
+	if err != nil {
+		fmt.Println("✘ Error while getting server "+server.Name+" for the restart warning:", err)
+		return
+	}
+
+	switch serv.Jeu {
+	case "Minecraft":
+		command, err := services.TellrawCommand("@a", services.Text(warningPrefix).WithColor("red").WithBold(), services.Text(message).WithColor("yellow"))
+		if err == nil {
+			host, port, password := db.GetRconAddress(server)
+			_, err = services.SendRconToMinecraftServer(host, port, password, command)
+		}
+		if err != nil {
+			fmt.Println("✘ Error while warning the players of "+server.Name+":", err)
+		}
+	case "Palworld":
+		if err := db.GetPalworldClient(server).Announce(warningPrefix + message); err != nil {
+			fmt.Println("✘ Error while warning the players of "+server.Name+":", err)
+		}
+	}
+
+	err = outbox.SendDiscordEmbed("mineotterBot", chatChannelID(serv), "⏳ Redémarrage de "+serv.Nom, message, serv.EmbedColor)
+	if err != nil {
+		fmt.Println("✘ Error while sending the restart warning of "+server.Name+":", err)
+	}
+}
+
+// chatChannelID returns the Discord chat channel of the game of a server
+func chatChannelID(serv models.Server) string {
+	if serv.Jeu == "Palworld" {
+		return config.AppConfig.DiscordChannels.PalworldChatChannelID
+	}
+	return config.AppConfig.DiscordChannels.MinecraftChatChannelID
+}
+
+// warnings returns the warning times of a server, in seconds
+func warnings(server models.ServerConfig) []int {
+	if len(server.RestartSchedule.WarningsSec) > 0 {
+		return server.RestartSchedule.WarningsSec
+	}
+	return defaultWarnings
+}
+
+// maxWarning returns the earliest warning of a server, in seconds
+func maxWarning(server models.ServerConfig) int {
+	maximum := 0
+	for _, seconds := range warnings(server) {
+		maximum = max(maximum, seconds)
+	}
+	return maximum
+}
+
+// formatRemaining returns the time left before a restart, like "5 minutes" or "10 secondes"
+func formatRemaining(remaining time.Duration) string {
+	seconds := int(remaining.Round(time.Second).Seconds())
+	switch {
+	case seconds >= 120:
+		return strconv.Itoa((seconds+30)/60) + " minutes"
+	case seconds >= 60:
+		return "1 minute"
+	case seconds > 1:
+		return strconv.Itoa(seconds) + " secondes"
+	default:
+		return "1 seconde"
+	}
+}
+
+// GetPending returns the pending restart of a server, the next one is scheduled if the daemon didn't do it yet
+func GetPending(serverID int) (PendingRestart, error) {
+	server, exists := db.GetServerConfigById(serverID)
+	if !exists || server.RestartSchedule.Cron == "" {
+		return PendingRestart{}, fmt.Errorf("ERROR: SERVER %d HAS NO RESTART SCHEDULE", serverID)
+	}
+	if _, err := ParseCron(server.RestartSchedule.Cron); err != nil {
+		return PendingRestart{}, err
+	}
+
+	state, err := updateState(func(state map[string]PendingRestart) bool {
+		return refreshPending(state, serverID, server, time.Now())
+	})
+	if err != nil {
+		return PendingRestart{}, err
+	}
+	restart, exists := state[strconv.Itoa(serverID)]
+	if !exists {
+		return PendingRestart{}, fmt.Errorf("ERROR: NO RESTART SCHEDULED FOR SERVER %s", server.Name)
+	}
+	return restart, nil
+}
+
+// ListPending returns the pending restarts of every server with a restart schedule, the nearest first
+func ListPending() ([]PendingRestart, error) {
+	var restarts []PendingRestart
+	for serverID := range scheduledServers() {
+		restart, err := GetPending(serverID)
+		if err != nil {
+			return nil, err
+		}
+		restarts = append(restarts, restart)
+	}
+	sort.Slice(restarts, func(i, j int) bool { return restarts[i].RestartAt.Before(restarts[j].RestartAt) })
+	return restarts, nil
+}
+
+// Postpone delays the pending restart of a server
+func Postpone(serverID int, delay time.Duration) (PendingRestart, error) {
+	return changePending(serverID, func(restart *PendingRestart) error {
+		if restart.Cancelled {
+			return fmt.Errorf("ERROR: THE RESTART OF SERVER %d IS CANCELLED", serverID)
+		}
+		restart.RestartAt = restart.RestartAt.Add(delay)
+		return nil
+	})
+}
+
+// Cancel cancels the pending restart of a server, the next one of its schedule still happens
+func Cancel(serverID int) (PendingRestart, error) {
+	return changePending(serverID, func(restart *PendingRestart) error {
+		restart.Cancelled = true
+		return nil
+	})
+}
+
+// changePending changes the pending restart of a server in the schedules file
+func changePending(serverID int, change func(restart *PendingRestart) error) (PendingRestart, error) {
+	if _, err := GetPending(serverID); err != nil {
+		return PendingRestart{}, err
+	}
+
+	var changed PendingRestart
+	var changeErr error
+	_, err := updateState(func(state map[string]PendingRestart) bool {
+		key := strconv.Itoa(serverID)
+		restart, exists := state[key]
+		if !exists {
+			changeErr = fmt.Errorf("ERROR: NO RESTART SCHEDULED FOR SERVER %d", serverID)
+			return false
+		}
+		if !time.Now().Before(restart.RestartAt) {
+			changeErr = fmt.Errorf("ERROR: THE RESTART OF SERVER %d IS ALREADY RUNNING", serverID)
+			return false
+		}
+		if changeErr = change(&restart); changeErr != nil {
+			return false
+		}
+		state[key] = restart
+		changed = restart
+		return true
+	})
+	if err != nil {
+		return PendingRestart{}, err
+	}
+	return changed, changeErr
+}
+
+// updateState reads the schedules file, applies a change and writes the file if the change returned true
+// A lock file keeps the daemon and the CLI from writing it at the same time
+func updateState(change func(state map[string]PendingRestart) bool) (map[string]PendingRestart, error) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	path := config.AppConfig.SchedulesFile
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	state := map[string]PendingRestart{}
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &state); err != nil {
+			return nil, fmt.Errorf("ERROR WHILE READING SCHEDULES FILE: %v", err)
+		}
+	}
+
+	if !change(state) {
+		return state, nil
+	}
+
+	content, err = json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return nil, err
+	}
+	return state, os.Rename(path+".tmp", path)
+}
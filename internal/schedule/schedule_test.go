@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+func TestRefreshPending(t *testing.T) {
+	server := models.ServerConfig{Name: "test", RestartSchedule: models.RestartScheduleConfig{Cron: "0 4 * * *"}}
+	now := time.Date(2025, 1, 12, 18, 0, 0, 0, time.UTC)
+	occurrence := time.Date(2025, 1, 13, 4, 0, 0, 0, time.UTC)
+	state := map[string]PendingRestart{}
+	key := strconv.Itoa(3)
+
+	if !refreshPending(state, 3, server, now) || !state[key].RestartAt.Equal(occurrence) {
+		t.Fatalf("first refresh = %+v", state)
+	}
+
+	// A postponed restart is kept until it is over
+	postponed := state[key]
+	postponed.RestartAt = occurrence.Add(30 * time.Minute)
+	state[key] = postponed
+	if refreshPending(state, 3, server, occurrence.Add(10*time.Minute)) {
+		t.Errorf("postponed restart replaced : %+v", state[key])
+	}
+
+	// A cancelled restart is replaced by the next one once its time passed
+	cancelled := state[key]
+	cancelled.Cancelled = true
+	state[key] = cancelled
+	if !refreshPending(state, 3, server, postponed.RestartAt) || !state[key].Occurrence.Equal(occurrence.AddDate(0, 0, 1)) || state[key].Cancelled {
+		t.Errorf("cancelled restart not replaced : %+v", state[key])
+	}
+
+	// A restart no longer in the schedule is replaced
+	server.RestartSchedule.Cron = "0 5 * * *"
+	if !refreshPending(state, 3, server, now) || state[key].Occurrence.Hour() != 5 {
+		t.Errorf("restart of the old schedule kept : %+v", state[key])
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	tests := map[time.Duration]string{
+		15 * time.Minute:                     "15 minutes",
+		5*time.Minute - 400*time.Millisecond: "5 minutes",
+		time.Minute:                          "1 minute",
+		10 * time.Second:                     "10 secondes",
+	}
+	for remaining, want := range tests {
+		if got := formatRemaining(remaining); got != want {
+			t.Errorf("formatRemaining(%v) = %q, want %q", remaining, got, want)
+		}
+	}
+}
+
+func TestNextEvent(t *testing.T) {
+	server := models.ServerConfig{Name: "test", RestartSchedule: models.RestartScheduleConfig{Cron: "0 4 * * *", WarningsSec: []int{900, 60}}}
+	restartAt := time.Date(2025, 1, 13, 4, 0, 0, 0, time.UTC)
+	restart := PendingRestart{ServerID: 3, Occurrence: restartAt, RestartAt: restartAt}
+
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{restartAt.Add(-time.Hour), restartAt.Add(-15 * time.Minute)},
+		{restartAt.Add(-15 * time.Minute), restartAt.Add(-time.Minute)},
+		{restartAt.Add(-30 * time.Second), restartAt},
+		{restartAt, time.Time{}},
+	}
+	for _, test := range tests {
+		if got := nextEvent(server, restart, test.now); !got.Equal(test.want) {
+			t.Errorf("nextEvent(%v) = %v, want %v", test.now, got, test.want)
+		}
+	}
+
+	restart.Cancelled = true
+	if got := nextEvent(server, restart, restartAt.Add(-time.Hour)); !got.IsZero() {
+		t.Errorf("nextEvent of a cancelled restart = %v", got)
+	}
+}
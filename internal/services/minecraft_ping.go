@@ -0,0 +1,313 @@
+package services
+
+// This file contains the Server List Ping of the Minecraft servers, the status shown in the server list of the game
+// It doesn't need RCON, only the game port of the server
+// The servers older than 1.7 don't know the handshake, they are asked with the legacy ping of 1.6
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Protocol version sent in the handshake, the servers answer with their status whatever the version
+const pingProtocolVersion = 767
+
+// Protocol version sent in the legacy ping, the one of 1.6.4
+const legacyPingProtocolVersion = 74
+
+var formattingCodeRegex = regexp.MustCompile(`§.`)
+
+// MinecraftServerStatus is the status of a Minecraft server
+type MinecraftServerStatus struct {
+	MOTD          string // Without the formatting codes
+	Version       string
+	Protocol      int
+	OnlinePlayers int
+	MaxPlayers    int
+	Sample        []string      // Names of some connected players, the server chooses which ones
+	Favicon       string        // Icon of the server, like "data:image/png;base64,..."
+	Latency       time.Duration // Time of the ping packet, or of the status request if the server doesn't answer the ping
+	Legacy        bool          // The status was read with the legacy ping
+}
+
+// PingMinecraftServer asks a Minecraft server its status with the Server List Ping
+// If the server doesn't understand the handshake, the legacy ping is tried
+func PingMinecraftServer(host string, port string, timeout time.Duration) (MinecraftServerStatus, error) {
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber <= 0 || portNumber > 65535 {
+		return MinecraftServerStatus{}, fmt.Errorf("ERROR: INVALID MINECRAFT PORT %q", port)
+	}
+
+	status, err := pingServer(host, portNumber, timeout)
+	if err == nil {
+		return status, nil
+	}
+	if _, isDialError := err.(*pingDialError); isDialError {
+		return status, err
+	}
+
+	legacyStatus, legacyErr := legacyPingServer(host, portNumber, timeout)
+	if legacyErr != nil {
+		return status, err
+	}
+	return legacyStatus, nil
+}
+
+// pingDialError is returned when the server can't be reached, the legacy ping is not tried then
+type pingDialError struct {
+	err error
+}
+
+func (e *pingDialError) Error() string {
+	return fmt.Sprintf("ERROR WHILE CONNECTING TO MINECRAFT SERVER: %v", e.err)
+}
+
+// pingServer asks the status with the handshake of 1.7 and later
+func pingServer(host string, port int, timeout time.Duration) (MinecraftServerStatus, error) {
+	var status MinecraftServerStatus
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return status, &pingDialError{err: err}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Handshake with the next state 1 (status), then the status request
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, pingProtocolVersion)
+	writeVarInt(&handshake, len(host))
+	handshake.WriteString(host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, 1)
+	if err := writePacket(conn, handshake.Bytes()); err != nil {
+		return status, err
+	}
+	start := time.Now()
+	if err := writePacket(conn, []byte{0x00}); err != nil {
+		return status, err
+	}
+
+	reader := bufio.NewReader(conn)
+	packet, err := readPacket(reader)
+	if err != nil {
+		return status, err
+	}
+	status.Latency = time.Since(start)
+
+	packetReader := bytes.NewReader(packet)
+	packetID, err := readVarInt(packetReader)
+	if err != nil || packetID != 0x00 {
+		return status, fmt.Errorf("ERROR: UNEXPECTED MINECRAFT STATUS PACKET %d", packetID)
+	}
+	length, err := readVarInt(packetReader)
+	if err != nil || length < 0 || length > packetReader.Len() {
+		return status, fmt.Errorf("ERROR WHILE READING MINECRAFT STATUS")
+	}
+	statusJSON := make([]byte, length)
+	io.ReadFull(packetReader, statusJSON)
+
+	var response struct {
+		Version struct {
+			Name     string `json:"name"`
+			Protocol int    `json:"protocol"`
+		} `json:"version"`
+		Players struct {
+			Max    int `json:"max"`
+			Online int `json:"online"`
+			Sample []struct {
+				Name string `json:"name"`
+			} `json:"sample"`
+		} `json:"players"`
+		Description interface{} `json:"description"` // A string or a text component
+		Favicon     string      `json:"favicon"`
+	}
+	if err := json.Unmarshal(statusJSON, &response); err != nil {
+		return status, fmt.Errorf("ERROR WHILE DECODING MINECRAFT STATUS: %v", err)
+	}
+	status.MOTD = cleanMOTD(componentText(response.Description))
+	status.Version = response.Version.Name
+	status.Protocol = response.Version.Protocol
+	status.OnlinePlayers = response.Players.Online
+	status.MaxPlayers = response.Players.Max
+	for _, player := range response.Players.Sample {
+		status.Sample = append(status.Sample, player.Name)
+	}
+	status.Favicon = response.Favicon
+
+	// The ping packet gives a better latency, the status request includes the time to build the status
+	payload := time.Now().UnixNano()
+	var ping bytes.Buffer
+	writeVarInt(&ping, 0x01)
+	binary.Write(&ping, binary.BigEndian, payload)
+	start = time.Now()
+	if writePacket(conn, ping.Bytes()) != nil {
+		return status, nil
+	}
+	pong, err := readPacket(reader)
+	if err == nil && len(pong) == 9 && pong[0] == 0x01 && int64(binary.BigEndian.Uint64(pong[1:])) == payload {
+		status.Latency = time.Since(start)
+	}
+	return status, nil
+}
+
+// legacyPingServer asks the status with the ping of 1.6, also understood by 1.4 and 1.5
+func legacyPingServer(host string, port int, timeout time.Duration) (MinecraftServerStatus, error) {
+	var status MinecraftServerStatus
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return status, &pingDialError{err: err}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	hostUTF16 := utf16.Encode([]rune(host))
+	var request bytes.Buffer
+	request.Write([]byte{0xFE, 0x01, 0xFA})
+	writeUTF16(&request, utf16.Encode([]rune("MC|PingHost")))
+	binary.Write(&request, binary.BigEndian, uint16(7+2*len(hostUTF16)))
+	request.WriteByte(legacyPingProtocolVersion)
+	writeUTF16(&request, hostUTF16)
+	binary.Write(&request, binary.BigEndian, int32(port))
+
+	start := time.Now()
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return status, fmt.Errorf("ERROR WHILE SENDING MINECRAFT LEGACY PING: %v", err)
+	}
+
+	// The answer is a kick packet: 0xFF, the length in characters, then the UTF-16 text
+	var header [3]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return status, fmt.Errorf("ERROR WHILE READING MINECRAFT LEGACY PING: %v", err)
+	}
+	if header[0] != 0xFF {
+		return status, fmt.Errorf("ERROR: UNEXPECTED MINECRAFT LEGACY PING PACKET %d", header[0])
+	}
+	text := make([]uint16, binary.BigEndian.Uint16(header[1:]))
+	if err := binary.Read(conn, binary.BigEndian, text); err != nil {
+		return status, fmt.Errorf("ERROR WHILE READING MINECRAFT LEGACY PING: %v", err)
+	}
+	status.Latency = time.Since(start)
+	status.Legacy = true
+
+	response := string(utf16.Decode(text))
+	if fields := strings.Split(response, "\x00"); len(fields) == 6 && fields[0] == "§1" {
+		// 1.4 and later: §1, protocol, version, MOTD, online players, max players
+		status.Protocol, _ = strconv.Atoi(fields[1])
+		status.Version = fields[2]
+		status.MOTD = cleanMOTD(fields[3])
+		status.OnlinePlayers, _ = strconv.Atoi(fields[4])
+		status.MaxPlayers, _ = strconv.Atoi(fields[5])
+		return status, nil
+	}
+	if fields := strings.Split(response, "§"); len(fields) >= 3 {
+		// Before 1.4: MOTD§online players§max players, the MOTD can't contain §
+		status.MOTD = strings.Join(fields[:len(fields)-2], "§")
+		status.OnlinePlayers, _ = strconv.Atoi(fields[len(fields)-2])
+		status.MaxPlayers, _ = strconv.Atoi(fields[len(fields)-1])
+		return status, nil
+	}
+	return status, fmt.Errorf("ERROR WHILE DECODING MINECRAFT LEGACY PING: %q", response)
+}
+
+// componentText returns the text of a JSON text component, its extra components included
+func componentText(component interface{}) string {
+	switch value := component.(type) {
+	case string:
+		return value
+	case []interface{}:
+		var builder strings.Builder
+		for _, part := range value {
+			builder.WriteString(componentText(part))
+		}
+		return builder.String()
+	case map[string]interface{}:
+		text := componentText(value["text"])
+		if extra, exists := value["extra"]; exists {
+			text += componentText(extra)
+		}
+		return text
+	}
+	return ""
+}
+
+// cleanMOTD removes the formatting codes and the spaces around the lines of a MOTD
+func cleanMOTD(motd string) string {
+	lines := strings.Split(formattingCodeRegex.ReplaceAllString(motd, ""), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// writeUTF16 writes a string of the legacy protocol: its length in characters, then its UTF-16 characters
+func writeUTF16(buffer *bytes.Buffer, text []uint16) {
+	binary.Write(buffer, binary.BigEndian, uint16(len(text)))
+	binary.Write(buffer, binary.BigEndian, text)
+}
+
+// writePacket writes a packet with its length before it
+func writePacket(writer io.Writer, data []byte) error {
+	var packet bytes.Buffer
+	writeVarInt(&packet, len(data))
+	packet.Write(data)
+	if _, err := writer.Write(packet.Bytes()); err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING MINECRAFT PACKET: %v", err)
+	}
+	return nil
+}
+
+// readPacket reads a packet and returns its content without its length
+func readPacket(reader *bufio.Reader) ([]byte, error) {
+	length, err := readVarInt(reader)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR WHILE READING MINECRAFT PACKET: %v", err)
+	}
+	if length <= 0 || length > 1<<21 {
+		return nil, fmt.Errorf("ERROR: INVALID MINECRAFT PACKET LENGTH %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(reader, packet); err != nil {
+		return nil, fmt.Errorf("ERROR WHILE READING MINECRAFT PACKET: %v", err)
+	}
+	return packet, nil
+}
+
+// writeVarInt writes an integer in the variable length format of the Minecraft protocol
+func writeVarInt(buffer *bytes.Buffer, value int) {
+	unsigned := uint32(value)
+	for {
+		if unsigned&^0x7F == 0 {
+			buffer.WriteByte(byte(unsigned))
+			return
+		}
+		buffer.WriteByte(byte(unsigned&0x7F | 0x80))
+		unsigned >>= 7
+	}
+}
+
+// readVarInt reads an integer in the variable length format of the Minecraft protocol
+func readVarInt(reader io.ByteReader) (int, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int(int32(value)), nil
+		}
+	}
+	return 0, fmt.Errorf("ERROR: MINECRAFT VARINT TOO LONG")
+}
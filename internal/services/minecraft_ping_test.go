@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// startFakeMinecraftServer starts a local server answering each connection with handle, and returns its port
+func startFakeMinecraftServer(t *testing.T, handle func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// modernHandler answers the status request with statusJSON, and the ping packet if answerPing is true
+func modernHandler(t *testing.T, statusJSON string, answerPing bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		handshake, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		handshakeReader := bytes.NewReader(handshake)
+		if id, _ := readVarInt(handshakeReader); id != 0x00 {
+			t.Errorf("handshake packet ID = %d", id)
+		}
+		readVarInt(handshakeReader) // Protocol
+		hostLength, _ := readVarInt(handshakeReader)
+		handshakeReader.Seek(int64(hostLength+2), io.SeekCurrent) // Host and port
+		if nextState, _ := readVarInt(handshakeReader); nextState != 1 {
+			t.Errorf("handshake next state = %d", nextState)
+		}
+
+		if request, err := readPacket(reader); err != nil || !bytes.Equal(request, []byte{0x00}) {
+			t.Errorf("status request = %v, %v", request, err)
+			return
+		}
+		var response bytes.Buffer
+		writeVarInt(&response, 0x00)
+		writeVarInt(&response, len(statusJSON))
+		response.WriteString(statusJSON)
+		writePacket(conn, response.Bytes())
+
+		ping, err := readPacket(reader)
+		if err != nil || !answerPing {
+			return
+		}
+		writePacket(conn, ping) // The pong is the same packet
+	}
+}
+
+// legacyHandler answers the legacy ping with a kick packet containing text
+func legacyHandler(t *testing.T, text string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		var first [3]byte
+		if _, err := io.ReadFull(conn, first[:]); err != nil {
+			return
+		}
+		if first != [3]byte{0xFE, 0x01, 0xFA} {
+			return // Not a legacy ping, like an old server receiving a handshake
+		}
+
+		encoded := utf16.Encode([]rune(text))
+		var response bytes.Buffer
+		response.WriteByte(0xFF)
+		binary.Write(&response, binary.BigEndian, uint16(len(encoded)))
+		binary.Write(&response, binary.BigEndian, encoded)
+		conn.Write(response.Bytes())
+	}
+}
+
+func TestPingMinecraftServer(t *testing.T) {
+	statusJSON := `{
+		"version": {"name": "1.21.1", "protocol": 767},
+		"players": {"max": 20, "online": 2, "sample": [{"name": "Loutre", "id": "1"}, {"name": "Castor", "id": "2"}]},
+		"description": {"text": "§aServeur ", "extra": [{"text": "Vanilla", "bold": true}, "\n§7Bienvenue"]},
+		"favicon": "data:image/png;base64,AAAA"
+	}`
+	port := startFakeMinecraftServer(t, modernHandler(t, statusJSON, true))
+
+	status, err := PingMinecraftServer("127.0.0.1", port, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != "1.21.1" || status.Protocol != 767 || status.Legacy {
+		t.Errorf("version = %q, protocol = %d, legacy = %v", status.Version, status.Protocol, status.Legacy)
+	}
+	if status.OnlinePlayers != 2 || status.MaxPlayers != 20 || strings.Join(status.Sample, ",") != "Loutre,Castor" {
+		t.Errorf("players = %d/%d %v", status.OnlinePlayers, status.MaxPlayers, status.Sample)
+	}
+	if status.MOTD != "Serveur Vanilla\nBienvenue" {
+		t.Errorf("MOTD = %q", status.MOTD)
+	}
+	if status.Favicon != "data:image/png;base64,AAAA" {
+		t.Errorf("favicon = %q", status.Favicon)
+	}
+	if status.Latency <= 0 {
+		t.Errorf("latency = %v", status.Latency)
+	}
+}
+
+func TestPingMinecraftServerWithoutPong(t *testing.T) {
+	port := startFakeMinecraftServer(t, modernHandler(t, `{"version":{"name":"Paper 1.20.4","protocol":765},"players":{"max":10,"online":0},"description":"Un serveur"}`, false))
+
+	status, err := PingMinecraftServer("127.0.0.1", port, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.MOTD != "Un serveur" || status.Version != "Paper 1.20.4" || status.Latency <= 0 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestPingMinecraftServerLegacy(t *testing.T) {
+	port := startFakeMinecraftServer(t, legacyHandler(t, "§1\x0074\x001.6.4\x00§cVieux serveur\x003\x0016"))
+
+	status, err := PingMinecraftServer("127.0.0.1", port, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Legacy || status.Protocol != 74 || status.Version != "1.6.4" {
+		t.Errorf("legacy = %v, protocol = %d, version = %q", status.Legacy, status.Protocol, status.Version)
+	}
+	if status.MOTD != "Vieux serveur" || status.OnlinePlayers != 3 || status.MaxPlayers != 16 {
+		t.Errorf("MOTD = %q, players = %d/%d", status.MOTD, status.OnlinePlayers, status.MaxPlayers)
+	}
+}
+
+func TestPingMinecraftServerBeta(t *testing.T) {
+	port := startFakeMinecraftServer(t, legacyHandler(t, "Serveur beta§1§8"))
+
+	status, err := PingMinecraftServer("127.0.0.1", port, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.MOTD != "Serveur beta" || status.OnlinePlayers != 1 || status.MaxPlayers != 8 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestPingMinecraftServerErrors(t *testing.T) {
+	if _, err := PingMinecraftServer("127.0.0.1", "abc", time.Second); err == nil {
+		t.Error("PingMinecraftServer() with an invalid port returned no error")
+	}
+
+	// A closed port is not tried with the legacy ping
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, closedPort, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	if _, err := PingMinecraftServer("127.0.0.1", closedPort, time.Second); err == nil {
+		t.Error("PingMinecraftServer() of a closed port returned no error")
+	}
+
+	port := startFakeMinecraftServer(t, func(conn net.Conn) {
+		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	})
+	if _, err := PingMinecraftServer("127.0.0.1", port, 500*time.Millisecond); err == nil {
+		t.Error("PingMinecraftServer() of a server that isn't Minecraft returned no error")
+	}
+}
+
+func TestVarInt(t *testing.T) {
+	for _, value := range []int{0, 1, 127, 128, 255, 25565, 2097151, 2147483647, -1} {
+		var buffer bytes.Buffer
+		writeVarInt(&buffer, value)
+		got, err := readVarInt(&buffer)
+		if err != nil || got != value {
+			t.Errorf("readVarInt(writeVarInt(%d)) = %d, %v", value, got, err)
+		}
+	}
+}
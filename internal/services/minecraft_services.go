@@ -6,25 +6,30 @@ import (
 	"io"
 	"net/http"
 	"regexp"
-	"github.com/gorcon/rcon"
+	"strings"
 )
 
 // SendRconToMinecraftServer sends a command to a Minecraft server using RCON
+// The connection of the server is kept open and reused by the next commands
 func SendRconToMinecraftServer(serverAddress, rconPort, rconPassword, command string) (string, error) {
-	addr := fmt.Sprintf("%s:%s", serverAddress, rconPort)
-	
-	client, err := rcon.Dial(addr, rconPassword)
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to RCON server: %w", err)
-	}
-	defer client.Close()
+	return ExecuteRcon(serverAddress, rconPort, rconPassword, command)
+}
 
-	resp, err := client.Execute(command)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute command: %w", err)
+// ParseMinecraftPlayerList returns the player names of the response of the "list" command
+// Like "There are 2 of a max of 20 players online: Steve, Alex", older versions use "There are 2/20 players online:"
+func ParseMinecraftPlayerList(response string) ([]string, error) {
+	_, names, found := strings.Cut(response, ":")
+	if !found || !strings.Contains(response, "players online") {
+		return nil, fmt.Errorf("ERROR WHILE READING MINECRAFT PLAYER LIST: %q", response)
 	}
 
-	return resp, nil
+	var players []string
+	for _, name := range strings.FieldsFunc(names, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			players = append(players, name)
+		}
+	}
+	return players, nil
 }
 
 // GetMinecraftPlayerUUID gets the UUID of a Minecraft player by their username
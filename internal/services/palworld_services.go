@@ -1,9 +1,270 @@
 package services
 
-import "fmt"
+// This file contains the client of the Palworld dedicated servers
+// The REST API is used when its URL is set, otherwise the commands are sent with RCON
 
-// GetPlfayerUUID gets the UUID of a player by their username, function is not implemented yet
-func GetPlayerUUID(playerName string) (string, error) {
-	fmt.Println("GetPlayerUUID called")
-	return "", nil
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PalworldClient talks to a Palworld dedicated server
+type PalworldClient struct {
+	RestURL      string // URL of the REST API, like "http://127.0.0.1:8212", empty to use RCON only
+	RestPassword string // Admin password of the server, the REST API user is always "admin"
+	RconHost     string
+	RconPort     string
+	RconPassword string
+	HTTPClient   *http.Client
+}
+
+// PalworldInfo is the description of a Palworld server
+type PalworldInfo struct {
+	Version     string `json:"version"`
+	ServerName  string `json:"servername"`
+	Description string `json:"description"`
+	WorldGUID   string `json:"worldguid"`
+}
+
+// PalworldPlayer is a player connected to a Palworld server
+type PalworldPlayer struct {
+	Name          string  `json:"name"`
+	AccountName   string  `json:"accountName"`
+	PlayerID      string  `json:"playerId"`
+	UserID        string  `json:"userId"` // Like "steam_76561198000000000", the same ID as in the "User id:" of the logs
+	IP            string  `json:"ip"`
+	Ping          float64 `json:"ping"`
+	LocationX     float64 `json:"location_x"`
+	LocationY     float64 `json:"location_y"`
+	Level         int     `json:"level"`
+	BuildingCount int     `json:"building_count"`
+}
+
+// PalworldMetrics are the performance metrics of a Palworld server
+type PalworldMetrics struct {
+	ServerFPS        int     `json:"serverfps"`
+	CurrentPlayerNum int     `json:"currentplayernum"`
+	ServerFrameTime  float64 `json:"serverframetime"`
+	MaxPlayerNum     int     `json:"maxplayernum"`
+	Uptime           int     `json:"uptime"` // In seconds
+	Days             int     `json:"days"`   // In game days
+}
+
+var (
+	palworldUserIDRegex = regexp.MustCompile(`\(User id: ([^)\s]+)\)`)
+	palworldInfoRegex   = regexp.MustCompile(`Welcome to Pal Server\[(.+?)\]\s*(.*)`)
+)
+
+// NewPalworldClient creates a client for a Palworld server
+func NewPalworldClient(restURL, restPassword, rconHost, rconPort, rconPassword string) *PalworldClient {
+	return &PalworldClient{
+		RestURL:      strings.TrimSuffix(restURL, "/"),
+		RestPassword: restPassword,
+		RconHost:     rconHost,
+		RconPort:     rconPort,
+		RconPassword: rconPassword,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ParsePalworldUserID returns the user ID written in a join line of the Palworld logs
+func ParsePalworldUserID(line string) (string, error) {
+	matches := palworldUserIDRegex.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		return "", fmt.Errorf("ERROR WHILE EXTRACTING PALWORLD USER ID")
+	}
+	return matches[1], nil
+}
+
+// Info returns the version and the name of the server
+func (c *PalworldClient) Info() (PalworldInfo, error) {
+	var info PalworldInfo
+	if c.RestURL != "" {
+		err := c.rest("GET", "/v1/api/info", nil, &info)
+		return info, err
+	}
+
+	resp, err := c.rcon("Info")
+	if err != nil {
+		return info, err
+	}
+	matches := palworldInfoRegex.FindStringSubmatch(resp)
+	if len(matches) < 3 {
+		return info, fmt.Errorf("ERROR WHILE READING PALWORLD INFO: %q", resp)
+	}
+	info.Version = matches[1]
+	info.ServerName = strings.TrimSpace(matches[2])
+	return info, nil
+}
+
+// Players returns the players connected to the server
+func (c *PalworldClient) Players() ([]PalworldPlayer, error) {
+	if c.RestURL != "" {
+		var result struct {
+			Players []PalworldPlayer `json:"players"`
+		}
+		err := c.rest("GET", "/v1/api/players", nil, &result)
+		return result.Players, err
+	}
+
+	// RCON answers with a CSV: name,playeruid,steamid
+	resp, err := c.rcon("ShowPlayers")
+	if err != nil {
+		return nil, err
+	}
+	var players []PalworldPlayer
+	for i, line := range strings.Split(strings.TrimSpace(resp), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if i == 0 || len(fields) < 3 {
+			continue // Header or empty line
+		}
+		players = append(players, PalworldPlayer{
+			Name:     fields[0],
+			PlayerID: fields[1],
+			UserID:   "steam_" + strings.TrimPrefix(fields[2], "steam_"),
+		})
+	}
+	return players, nil
+}
+
+// GetPlayerUserID returns the user ID of a connected player
+func (c *PalworldClient) GetPlayerUserID(playerName string) (string, error) {
+	players, err := c.Players()
+	if err != nil {
+		return "", err
+	}
+	for _, player := range players {
+		if player.Name == playerName {
+			return player.UserID, nil
+		}
+	}
+	return "", fmt.Errorf("PALWORLD PLAYER %s NOT FOUND", playerName)
+}
+
+// Metrics returns the performance metrics of the server, only available with the REST API
+func (c *PalworldClient) Metrics() (PalworldMetrics, error) {
+	var metrics PalworldMetrics
+	if c.RestURL == "" {
+		return metrics, fmt.Errorf("ERROR: PALWORLD METRICS NEED THE REST API")
+	}
+	err := c.rest("GET", "/v1/api/metrics", nil, &metrics)
+	return metrics, err
+}
+
+// Announce shows a message to every player
+func (c *PalworldClient) Announce(message string) error {
+	if c.RestURL != "" {
+		return c.rest("POST", "/v1/api/announce", map[string]interface{}{"message": message}, nil)
+	}
+	_, err := c.rcon("Broadcast " + rconArgument(message))
+	return err
+}
+
+// Kick disconnects a player
+func (c *PalworldClient) Kick(userID string, message string) error {
+	if c.RestURL != "" {
+		return c.rest("POST", "/v1/api/kick", map[string]interface{}{"userid": userID, "message": message}, nil)
+	}
+	_, err := c.rcon("KickPlayer " + strings.TrimPrefix(userID, "steam_"))
+	return err
+}
+
+// Ban bans a player
+func (c *PalworldClient) Ban(userID string, message string) error {
+	if c.RestURL != "" {
+		return c.rest("POST", "/v1/api/ban", map[string]interface{}{"userid": userID, "message": message}, nil)
+	}
+	_, err := c.rcon("BanPlayer " + strings.TrimPrefix(userID, "steam_"))
+	return err
+}
+
+// Save saves the world
+func (c *PalworldClient) Save() error {
+	if c.RestURL != "" {
+		return c.rest("POST", "/v1/api/save", nil, nil)
+	}
+	_, err := c.rcon("Save")
+	return err
+}
+
+// Shutdown stops the server after a delay in seconds, showing a message to the players
+func (c *PalworldClient) Shutdown(waitTime int, message string) error {
+	if c.RestURL != "" {
+		return c.rest("POST", "/v1/api/shutdown", map[string]interface{}{"waittime": waitTime, "message": message}, nil)
+	}
+	_, err := c.rcon(fmt.Sprintf("Shutdown %d %s", waitTime, rconArgument(message)))
+	return err
+}
+
+// rcon sends a command with RCON
+func (c *PalworldClient) rcon(command string) (string, error) {
+	if c.RconPassword == "" {
+		return "", fmt.Errorf("ERROR: NO REST API URL OR RCON PASSWORD SET FOR PALWORLD SERVER %s", c.RconHost)
+	}
+	return ExecuteRcon(c.RconHost, c.RconPort, c.RconPassword, command)
+}
+
+// rconArgument makes a text usable as a Palworld RCON argument
+// Palworld cuts the arguments at the first space and doesn't show the characters outside of ASCII
+func rconArgument(text string) string {
+	var builder strings.Builder
+	for _, char := range text {
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			builder.WriteRune('_')
+		case char < 128:
+			builder.WriteRune(char)
+		default:
+			builder.WriteRune('?')
+		}
+	}
+	return builder.String()
+}
+
+// rest sends a request to the REST API and decodes its JSON response in result, result can be nil
+func (c *PalworldClient) rest(method string, path string, payload any, result any) error {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("ERROR WHILE SERIALISING PALWORLD PAYLOAD: %v", err)
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequest(method, c.RestURL+path, body)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE CREATING PALWORLD REQUEST: %v", err)
+	}
+	req.SetBasicAuth("admin", c.RestPassword)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING PALWORLD REQUEST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE READING PALWORLD RESPONSE: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PALWORLD API RESPONSE STATUS: %v, RESPONSE BODY: %s", resp.Status, respBody)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("ERROR WHILE READING PALWORLD RESPONSE: %v", err)
+		}
+	}
+	return nil
 }
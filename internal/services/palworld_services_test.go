@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakePalworldServer is a local Palworld REST API recording the requests it receives
+type fakePalworldServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests map[string]map[string]interface{} // Path -> decoded body
+}
+
+func newFakePalworldServer(t *testing.T, password string) *fakePalworldServer {
+	fake := &fakePalworldServer{requests: map[string]map[string]interface{}{}}
+	responses := map[string]string{
+		"GET /v1/api/info":    `{"version":"v0.3.2.55","servername":"Serveur Palworld","description":"","worldguid":"ABC"}`,
+		"GET /v1/api/players": `{"players":[{"name":"Loutre","accountName":"loutre","playerId":"1A2B","userId":"steam_76561198000000001","ip":"10.0.0.2","ping":12.5,"location_x":1,"location_y":2,"level":20,"building_count":4}]}`,
+		"GET /v1/api/metrics": `{"serverfps":58,"currentplayernum":1,"serverframetime":17.2,"maxplayernum":32,"uptime":3600,"days":12}`,
+	}
+
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var body map[string]interface{}
+		if r.Method == http.MethodPost {
+			data, _ := io.ReadAll(r.Body)
+			if len(data) > 0 {
+				if err := json.Unmarshal(data, &body); err != nil {
+					t.Errorf("invalid JSON body for %s: %s", r.URL.Path, data)
+				}
+			}
+		}
+		fake.mutex.Lock()
+		fake.requests[r.URL.Path] = body
+		fake.mutex.Unlock()
+
+		if response, exists := responses[r.Method+" "+r.URL.Path]; exists {
+			w.Write([]byte(response))
+			return
+		}
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakePalworldServer) request(path string) (map[string]interface{}, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	body, exists := f.requests[path]
+	return body, exists
+}
+
+func TestPalworldClientRead(t *testing.T) {
+	fake := newFakePalworldServer(t, "secret")
+	client := NewPalworldClient(fake.URL+"/", "secret", "", "", "")
+
+	info, err := client.Info()
+	if err != nil || info.Version != "v0.3.2.55" || info.ServerName != "Serveur Palworld" {
+		t.Errorf("Info() = %+v, %v", info, err)
+	}
+
+	players, err := client.Players()
+	if err != nil || len(players) != 1 || players[0].Name != "Loutre" || players[0].Level != 20 {
+		t.Errorf("Players() = %+v, %v", players, err)
+	}
+
+	userID, err := client.GetPlayerUserID("Loutre")
+	if err != nil || userID != "steam_76561198000000001" {
+		t.Errorf("GetPlayerUserID() = %q, %v", userID, err)
+	}
+	if _, err := client.GetPlayerUserID("Absent"); err == nil {
+		t.Error("GetPlayerUserID() of a player not connected returned no error")
+	}
+
+	metrics, err := client.Metrics()
+	if err != nil || metrics.ServerFPS != 58 || metrics.MaxPlayerNum != 32 || metrics.Uptime != 3600 {
+		t.Errorf("Metrics() = %+v, %v", metrics, err)
+	}
+}
+
+func TestPalworldClientActions(t *testing.T) {
+	fake := newFakePalworldServer(t, "secret")
+	client := NewPalworldClient(fake.URL, "secret", "", "", "")
+
+	message := `Hello "world" \ <b>`
+	if err := client.Announce(message); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := fake.request("/v1/api/announce"); body["message"] != message {
+		t.Errorf("announce body = %v", body)
+	}
+
+	if err := client.Kick("steam_1", "Bye"); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := fake.request("/v1/api/kick"); body["userid"] != "steam_1" || body["message"] != "Bye" {
+		t.Errorf("kick body = %v", body)
+	}
+
+	if err := client.Ban("steam_2", "Banned"); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := fake.request("/v1/api/ban"); body["userid"] != "steam_2" {
+		t.Errorf("ban body = %v", body)
+	}
+
+	if err := client.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := fake.request("/v1/api/save"); !exists {
+		t.Error("save was not requested")
+	}
+
+	if err := client.Shutdown(30, "Redémarrage"); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := fake.request("/v1/api/shutdown"); body["waittime"] != float64(30) || body["message"] != "Redémarrage" {
+		t.Errorf("shutdown body = %v", body)
+	}
+}
+
+func TestPalworldClientWrongPassword(t *testing.T) {
+	fake := newFakePalworldServer(t, "secret")
+	client := NewPalworldClient(fake.URL, "wrong", "", "", "")
+
+	if _, err := client.Info(); err == nil {
+		t.Error("Info() with a wrong password returned no error")
+	}
+	if err := client.Announce("test"); err == nil {
+		t.Error("Announce() with a wrong password returned no error")
+	}
+}
+
+func TestPalworldClientWithoutRestOrRcon(t *testing.T) {
+	client := NewPalworldClient("", "", "127.0.0.1", "25575", "")
+	if err := client.Announce("test"); err == nil {
+		t.Error("Announce() without REST API or RCON password returned no error")
+	}
+	if _, err := client.Metrics(); err == nil {
+		t.Error("Metrics() without REST API returned no error")
+	}
+}
+
+func TestParsePalworldUserID(t *testing.T) {
+	line := "[2025-01-12 18:03:44] [LOG] Loutre 10.0.0.2 connected the server. (User id: steam_76561198000000001)"
+	userID, err := ParsePalworldUserID(line)
+	if err != nil || userID != "steam_76561198000000001" {
+		t.Errorf("ParsePalworldUserID() = %q, %v", userID, err)
+	}
+
+	if _, err := ParsePalworldUserID("[2025-01-12 18:03:44] [LOG] Loutre left the server."); err == nil {
+		t.Error("ParsePalworldUserID() of a line without user ID returned no error")
+	}
+}
+
+func TestRconArgument(t *testing.T) {
+	if got := rconArgument("Salut à tous\n!"); got != "Salut_?_tous_!" {
+		t.Errorf("rconArgument() = %q", got)
+	}
+}
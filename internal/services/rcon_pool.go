@@ -0,0 +1,241 @@
+package services
+
+// This file contains the RCON connections pool, one authenticated connection is kept for each server address
+// Reusing the connections avoids a new login, and a "Thread RCON Client started" line, for every command
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorcon/rcon"
+)
+
+const (
+	rconTimeout         = 5 * time.Second  // Timeout of the connection and of each command
+	rconMaxRetryDelay   = 60 * time.Second // Maximum delay between two connection attempts to an unreachable server
+	rconFirstRetryDelay = time.Second      // Delay after the first failed attempt, doubled after each failure
+)
+
+// RconHealth is the state of the RCON connection of a server
+type RconHealth struct {
+	Address     string
+	Connected   bool      // An authenticated connection is open
+	Failures    int       // Number of failures since the last success
+	LastError   string    // Error of the last failure
+	LastSuccess time.Time // Time of the last command executed
+	LastFailure time.Time // Time of the last failure
+	NextAttempt time.Time // Before this time, the commands fail without trying to connect
+}
+
+// rconConnection is the connection of a server, its mutex serialises the commands
+type rconConnection struct {
+	mutex    sync.Mutex
+	password string
+	conn     *rcon.Conn
+	netConn  *rconNetConn
+	health   RconHealth
+}
+
+// rconNetConn is the network connection under an RCON connection
+// It tells if a command was written to the server, and if the server closed the connection while it was idle
+type rconNetConn struct {
+	net.Conn
+	written bool   // A write succeeded since the last reset
+	peeked  []byte // Bytes read while checking the connection, given to the next read
+}
+
+var (
+	rconConnections      = map[string]*rconConnection{}
+	rconConnectionsMutex sync.Mutex
+)
+
+// ExecuteRcon runs a command on a server, using the open connection of the server if there is one
+func ExecuteRcon(serverAddress, rconPort, rconPassword, command string) (string, error) {
+	connection := getRconConnection(net.JoinHostPort(serverAddress, rconPort))
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	// A new password means a new server configuration, the old connection can't be trusted
+	if connection.conn != nil && connection.password != rconPassword {
+		connection.close()
+	}
+
+	// The connection of a server that was just restarted was closed by the server, a new one is opened before sending the command
+	reused := connection.conn != nil
+	if reused && !connection.netConn.alive() {
+		connection.close()
+	}
+
+	// A failure is only retried if the command was never written, a command the server may have received is never sent twice
+	resp, err := connection.execute(rconPassword, command)
+	if err != nil && reused && !connection.sent() && time.Now().After(connection.health.NextAttempt) {
+		resp, err = connection.execute(rconPassword, command)
+	}
+	return resp, err
+}
+
+// GetRconHealth returns the state of the RCON connection of a server
+func GetRconHealth(serverAddress, rconPort string) RconHealth {
+	address := net.JoinHostPort(serverAddress, rconPort)
+	rconConnectionsMutex.Lock()
+	connection, exists := rconConnections[address]
+	rconConnectionsMutex.Unlock()
+	if !exists {
+		return RconHealth{Address: address}
+	}
+
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	return connection.health
+}
+
+// GetAllRconHealth returns the state of the RCON connection of every server used since the start
+func GetAllRconHealth() []RconHealth {
+	rconConnectionsMutex.Lock()
+	connections := make([]*rconConnection, 0, len(rconConnections))
+	for _, connection := range rconConnections {
+		connections = append(connections, connection)
+	}
+	rconConnectionsMutex.Unlock()
+
+	var healths []RconHealth
+	for _, connection := range connections {
+		connection.mutex.Lock()
+		healths = append(healths, connection.health)
+		connection.mutex.Unlock()
+	}
+	return healths
+}
+
+// CloseRconConnections closes every open RCON connection
+func CloseRconConnections() {
+	rconConnectionsMutex.Lock()
+	defer rconConnectionsMutex.Unlock()
+	for _, connection := range rconConnections {
+		connection.mutex.Lock()
+		connection.close()
+		connection.mutex.Unlock()
+	}
+}
+
+// getRconConnection returns the connection of an address, creating it on the first command
+func getRconConnection(address string) *rconConnection {
+	rconConnectionsMutex.Lock()
+	defer rconConnectionsMutex.Unlock()
+
+	connection, exists := rconConnections[address]
+	if !exists {
+		connection = &rconConnection{health: RconHealth{Address: address}}
+		rconConnections[address] = connection
+	}
+	return connection
+}
+
+// execute runs a command, connecting first if needed, the mutex must be locked
+func (c *rconConnection) execute(password string, command string) (string, error) {
+	if c.conn == nil {
+		if wait := time.Until(c.health.NextAttempt); wait > 0 {
+			return "", fmt.Errorf("RCON OF %s UNAVAILABLE, NEXT ATTEMPT IN %v: %s", c.health.Address, wait.Round(time.Second), c.health.LastError)
+		}
+
+		c.netConn = nil
+		netConn, err := net.DialTimeout("tcp", c.health.Address, rconTimeout)
+		if err != nil {
+			c.fail(err)
+			return "", fmt.Errorf("failed to connect to RCON server: %w", err)
+		}
+		tracked := &rconNetConn{Conn: netConn}
+		conn, err := rcon.Open(tracked, password, rcon.SetDeadline(rconTimeout))
+		if err != nil {
+			c.fail(err)
+			return "", fmt.Errorf("failed to connect to RCON server: %w", err)
+		}
+		c.conn = conn
+		c.netConn = tracked
+		c.password = password
+		c.health.Connected = true
+		if c.health.Failures > 0 {
+			fmt.Printf("✔ RCON connection to %s restored after %d failures.\n", c.health.Address, c.health.Failures)
+		}
+	}
+
+	c.netConn.written = false
+	resp, err := c.conn.Execute(command)
+	if err != nil {
+		c.close()
+		c.fail(err)
+		return "", fmt.Errorf("failed to execute command: %w", err)
+	}
+
+	c.health.Failures = 0
+	c.health.LastError = ""
+	c.health.NextAttempt = time.Time{}
+	c.health.LastSuccess = time.Now()
+	return resp, nil
+}
+
+// fail records a failure and delays the next connection attempt, the mutex must be locked
+func (c *rconConnection) fail(err error) {
+	c.health.Failures++
+	c.health.LastError = err.Error()
+	c.health.LastFailure = time.Now()
+
+	// The first failure is retried right away, it's often a connection closed by a restart
+	if c.health.Failures > 1 {
+		delay := rconFirstRetryDelay << min(c.health.Failures-2, 6)
+		if delay > rconMaxRetryDelay {
+			delay = rconMaxRetryDelay
+		}
+		c.health.NextAttempt = time.Now().Add(delay)
+	}
+}
+
+// sent tells if the last command was written to the server, the mutex must be locked
+func (c *rconConnection) sent() bool {
+	return c.netConn != nil && c.netConn.written
+}
+
+// close closes the connection, the mutex must be locked
+func (c *rconConnection) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.health.Connected = false
+}
+
+// Write writes to the connection and records that the server may have received a command
+func (n *rconNetConn) Write(b []byte) (int, error) {
+	written, err := n.Conn.Write(b)
+	if err == nil {
+		n.written = true
+	}
+	return written, err
+}
+
+// Read reads the bytes peeked by alive first, then the connection
+func (n *rconNetConn) Read(b []byte) (int, error) {
+	if len(n.peeked) > 0 {
+		read := copy(b, n.peeked)
+		n.peeked = n.peeked[read:]
+		return read, nil
+	}
+	return n.Conn.Read(b)
+}
+
+// alive tells if the server didn't close the connection, without waiting for it
+// An idle RCON connection receives nothing, so a read that doesn't time out means the connection was closed
+func (n *rconNetConn) alive() bool {
+	if err := n.Conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+	buffer := make([]byte, 64)
+	read, err := n.Conn.Read(buffer)
+	n.peeked = append(n.peeked, buffer[:read]...)
+
+	var netErr net.Error
+	return err == nil || errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/gorcon/rcon"
+)
+
+// fakeRconServer is an RCON server whose answer to each command is decided by the test
+type fakeRconServer struct {
+	listener net.Listener
+	answer   func(conn net.Conn, request *rcon.Packet) // Answers a command, or closes the connection
+	mutex    sync.Mutex
+	commands []string
+	accepted int
+}
+
+func newFakeRconServer(t *testing.T, answer func(conn net.Conn, request *rcon.Packet)) *fakeRconServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRconServer{listener: listener, answer: answer}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mutex.Lock()
+			server.accepted++
+			server.mutex.Unlock()
+			go server.handle(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRconServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		request := &rcon.Packet{}
+		if _, err := request.ReadFrom(conn); err != nil {
+			return
+		}
+		switch request.Type {
+		case rcon.SERVERDATA_AUTH:
+			rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, request.ID, "").WriteTo(conn)
+			rcon.NewPacket(rcon.SERVERDATA_AUTH_RESPONSE, request.ID, "").WriteTo(conn)
+		case rcon.SERVERDATA_EXECCOMMAND:
+			s.mutex.Lock()
+			s.commands = append(s.commands, request.Body())
+			s.mutex.Unlock()
+			s.answer(conn, request)
+		}
+	}
+}
+
+func (s *fakeRconServer) counts() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.commands), s.accepted
+}
+
+func (s *fakeRconServer) execute(command string) (string, error) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return ExecuteRcon(host, port, "password", command)
+}
+
+func echo(conn net.Conn, request *rcon.Packet) {
+	rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, request.ID, "done: "+request.Body()).WriteTo(conn)
+}
+
+// TestRconStaleConnection checks that a connection closed by the server, like after a restart, is replaced before the command is sent
+func TestRconStaleConnection(t *testing.T) {
+	closed := make(chan struct{})
+	server := newFakeRconServer(t, func(conn net.Conn, request *rcon.Packet) {
+		echo(conn, request)
+		if request.Body() == "save-all" {
+			conn.Close() // The server restarts after the first command
+			close(closed)
+		}
+	})
+	defer CloseRconConnections()
+
+	if _, err := server.execute("save-all"); err != nil {
+		t.Fatal(err)
+	}
+	<-closed
+	resp, err := server.execute("say hello")
+	if err != nil || resp != "done: say hello" {
+		t.Fatalf("command after the restart = %q, %v", resp, err)
+	}
+	if commands, accepted := server.counts(); commands != 2 || accepted != 2 {
+		t.Errorf("%d commands received on %d connections, want 2 on 2", commands, accepted)
+	}
+}
+
+// TestRconNotRetriedAfterWrite checks that a command is never sent twice when the server received it and didn't answer
+func TestRconNotRetriedAfterWrite(t *testing.T) {
+	server := newFakeRconServer(t, func(conn net.Conn, request *rcon.Packet) {
+		if request.Body() == "stop" {
+			conn.Close() // The server stops before answering
+			return
+		}
+		echo(conn, request)
+	})
+	defer CloseRconConnections()
+
+	if _, err := server.execute("list"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.execute("stop"); err == nil {
+		t.Fatal("stop without answer succeeded")
+	}
+	if commands, _ := server.counts(); commands != 2 {
+		t.Errorf("%d commands received, want 2 (stop sent once)", commands)
+	}
+}
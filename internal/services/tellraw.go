@@ -0,0 +1,134 @@
+package services
+
+// This file contains the builder of the Minecraft text components sent with the tellraw command
+// The components are serialised with encoding/json, so a chat message can't close a string and add its own components
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Click event actions of a text component
+const (
+	ClickOpenURL         = "open_url"
+	ClickRunCommand      = "run_command"
+	ClickSuggestCommand  = "suggest_command"
+	ClickCopyToClipboard = "copy_to_clipboard"
+)
+
+// Named colours accepted by Minecraft
+var minecraftColors = map[string]bool{
+	"black": true, "dark_blue": true, "dark_green": true, "dark_aqua": true,
+	"dark_red": true, "dark_purple": true, "gold": true, "gray": true,
+	"dark_gray": true, "blue": true, "green": true, "aqua": true,
+	"red": true, "light_purple": true, "yellow": true, "white": true,
+}
+
+var hexColorRegex = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// TextComponent is a Minecraft JSON text component
+type TextComponent struct {
+	Text       string          `json:"text"`
+	Color      string          `json:"color,omitempty"`
+	Bold       bool            `json:"bold,omitempty"`
+	Italic     bool            `json:"italic,omitempty"`
+	Underlined bool            `json:"underlined,omitempty"`
+	HoverEvent *HoverEvent     `json:"hoverEvent,omitempty"`
+	ClickEvent *ClickEvent     `json:"clickEvent,omitempty"`
+	Extra      []TextComponent `json:"extra,omitempty"`
+}
+
+// HoverEvent shows a text when the mouse is over a component
+type HoverEvent struct {
+	Action   string `json:"action"`
+	Contents string `json:"contents"`
+}
+
+// ClickEvent runs an action when a component is clicked
+type ClickEvent struct {
+	Action string `json:"action"`
+	Value  string `json:"value"`
+}
+
+// Text creates a text component
+func Text(text string) TextComponent {
+	return TextComponent{Text: text}
+}
+
+// WithColor sets the colour of a component, a named colour or a #RRGGBB colour
+// An unknown colour is ignored, Minecraft would refuse the whole command
+func (c TextComponent) WithColor(color string) TextComponent {
+	color = strings.TrimSpace(color)
+	if minecraftColors[strings.ToLower(color)] {
+		c.Color = strings.ToLower(color)
+	} else if hexColorRegex.MatchString(color) {
+		c.Color = strings.ToUpper(color)
+	}
+	return c
+}
+
+// WithBold makes a component bold
+func (c TextComponent) WithBold() TextComponent {
+	c.Bold = true
+	return c
+}
+
+// WithItalic makes a component italic
+func (c TextComponent) WithItalic() TextComponent {
+	c.Italic = true
+	return c
+}
+
+// WithUnderline underlines a component
+func (c TextComponent) WithUnderline() TextComponent {
+	c.Underlined = true
+	return c
+}
+
+// WithHoverText shows a text when the mouse is over a component
+func (c TextComponent) WithHoverText(text string) TextComponent {
+	c.HoverEvent = &HoverEvent{Action: "show_text", Contents: text}
+	return c
+}
+
+// WithClick runs an action when a component is clicked, the action is one of the Click* constants
+func (c TextComponent) WithClick(action string, value string) TextComponent {
+	c.ClickEvent = &ClickEvent{Action: action, Value: value}
+	return c
+}
+
+// WithExtra adds components after a component, they inherit its style
+func (c TextComponent) WithExtra(components ...TextComponent) TextComponent {
+	c.Extra = append(c.Extra, components...)
+	return c
+}
+
+// TellrawCommand creates a tellraw command showing the components to the target, like "@a"
+func TellrawCommand(target string, components ...TextComponent) (string, error) {
+	// The empty string first keeps the components from inheriting the style of the first one
+	list := []interface{}{""}
+	for _, component := range components {
+		list = append(list, component)
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(list); err != nil {
+		return "", fmt.Errorf("ERROR WHILE CREATING TELLRAW COMMAND: %v", err)
+	}
+	return "tellraw " + target + " " + strings.TrimSpace(buffer.String()), nil
+}
+
+// PlainText returns the text of components without their style, for the games that don't use text components
+func PlainText(components ...TextComponent) string {
+	var builder strings.Builder
+	for _, component := range components {
+		builder.WriteString(component.Text)
+		builder.WriteString(PlainText(component.Extra...))
+	}
+	return builder.String()
+}
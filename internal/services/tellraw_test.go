@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// parseTellraw returns the components of a tellraw command sent to @a
+func parseTellraw(t *testing.T, command string) []json.RawMessage {
+	t.Helper()
+	payload, found := strings.CutPrefix(command, "tellraw @a ")
+	if !found {
+		t.Fatalf("command %q doesn't start with tellraw @a", command)
+	}
+
+	var components []json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &components); err != nil {
+		t.Fatalf("command %q is not a valid JSON array: %v", command, err)
+	}
+	return components
+}
+
+func TestTellrawCommandHostileMessages(t *testing.T) {
+	messages := []string{
+		`"}`,
+		`\`,
+		`\"},{"text":"pwned","clickEvent":{"action":"run_command","value":"/op Steve"}},{"text":"`,
+		`"]} ; say injected`,
+		"line\nbreak\ttab",
+		`§kobfuscated§r <b>html</b> & friends`,
+		"  \x00",
+		`{"translate":"chat.type.admin"}`,
+	}
+
+	for _, message := range messages {
+		command, err := TellrawCommand("@a", Text("<Steve>").WithColor("#00FF00"), Text(" "+message))
+		if err != nil {
+			t.Fatalf("TellrawCommand(%q) returned an error: %v", message, err)
+		}
+
+		components := parseTellraw(t, command)
+		if len(components) != 3 {
+			t.Fatalf("message %q gave %d components, want 3: %s", message, len(components), command)
+		}
+
+		var text TextComponent
+		if err := json.Unmarshal(components[2], &text); err != nil {
+			t.Fatalf("message %q gave an invalid component: %v", message, err)
+		}
+		if text.Text != " "+message {
+			t.Errorf("message %q was changed to %q", message, text.Text)
+		}
+		if text.ClickEvent != nil || text.HoverEvent != nil || len(text.Extra) > 0 {
+			t.Errorf("message %q added events or components: %s", message, components[2])
+		}
+	}
+}
+
+func TestTellrawCommandEvents(t *testing.T) {
+	command, err := TellrawCommand("@a",
+		Text("[image.png]").WithColor("aqua").WithUnderline().
+			WithClick(ClickOpenURL, `https://example.com/a"b.png`).
+			WithHoverText(`Ouvrir "image"`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	components := parseTellraw(t, command)
+	var link TextComponent
+	if err := json.Unmarshal(components[1], &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.ClickEvent == nil || link.ClickEvent.Action != ClickOpenURL || link.ClickEvent.Value != `https://example.com/a"b.png` {
+		t.Errorf("click event not kept: %s", components[1])
+	}
+	if link.HoverEvent == nil || link.HoverEvent.Contents != `Ouvrir "image"` {
+		t.Errorf("hover event not kept: %s", components[1])
+	}
+	if !link.Underlined || link.Color != "aqua" {
+		t.Errorf("style not kept: %s", components[1])
+	}
+}
+
+func TestWithColor(t *testing.T) {
+	tests := map[string]string{
+		"yellow":                   "yellow",
+		"Dark_Red":                 "dark_red",
+		"#ff00aa":                  "#FF00AA",
+		" #123456 ":                "#123456",
+		"#12345":                   "",
+		"notacolor":                "",
+		`red","clickEvent":{"a":1`: "",
+	}
+
+	for color, want := range tests {
+		if got := Text("x").WithColor(color).Color; got != want {
+			t.Errorf("WithColor(%q) = %q, want %q", color, got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package status
+
+// The status messages show the state of each server in Discord, one pinned message per server edited in place
+// The IDs of the messages are kept in a file, so the same messages are edited after a restart of the daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/discord"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/roster"
+)
+
+// Colour of the message of an offline server
+const offlineColor = "#747f8d"
+
+// statusMessage is the Discord message of a server, kept in the messages file
+type statusMessage struct {
+	ChannelID string    `json:"channelID"`
+	MessageID string    `json:"messageID"`
+	LastStart time.Time `json:"lastStart"` // Kept to show the last start while the server is offline
+}
+
+// The messages are only used by the update loop, so they don't need a mutex
+var (
+	messages     = map[string]statusMessage{} // Server ID -> message
+	lastPayloads = map[string]string{}        // Server ID -> last payload sent, to edit only what changed
+)
+
+// Start updates the status messages at each interval, it never returns without an error
+func Start() error {
+	settings := config.AppConfig.StatusMessage
+	botToken := config.AppConfig.Bots[settings.Bot].BotToken
+	if botToken == "" {
+		return fmt.Errorf("ERROR: BOT TOKEN NOT SET FOR STATUS MESSAGE BOT %s", settings.Bot)
+	}
+	if settings.ChannelID == "" {
+		return fmt.Errorf("ERROR: NO STATUS MESSAGE CHANNEL SET")
+	}
+
+	if err := loadMessages(); err != nil {
+		return err
+	}
+	fmt.Printf("✔ Status messages started, interval is set to %d seconds.\n", settings.IntervalSec)
+
+	for {
+		// The first update waits for the roster to read the servers
+		time.Sleep(time.Duration(settings.IntervalSec) * time.Second)
+		Update()
+	}
+}
+
+// Update edits the status message of each listened server, a message is sent and pinned if it doesn't exist yet
+func Update() {
+	settings := config.AppConfig.StatusMessage
+	botToken := config.AppConfig.Bots[settings.Bot].BotToken
+
+	changed := false
+	for _, server := range config.AppConfig.Servers {
+		if server.Disabled {
+			continue
+		}
+		serv, err := db.GetServerById(db.ResolveServerID(server))
+		if err != nil {
+			continue
+		}
+
+		key := strconv.Itoa(serv.ID)
+		message := messages[key]
+		serverRoster := roster.Get(serv.ID)
+		if !serverRoster.OnlineSince.IsZero() && !serverRoster.OnlineSince.Equal(message.LastStart) {
+			message.LastStart = serverRoster.OnlineSince
+			changed = true
+		}
+
+		payload, err := statusPayload(serv, serverRoster, message.LastStart)
+		if err != nil {
+			fmt.Println("✘ Error while creating the status message of "+serv.Nom+":", err)
+			continue
+		}
+		payloadBytes, _ := json.Marshal(payload)
+		if message.ChannelID == settings.ChannelID && message.MessageID != "" && lastPayloads[key] == string(payloadBytes) {
+			messages[key] = message
+			continue // Nothing changed since the last edit
+		}
+
+		messageID, err := sendStatusMessage(botToken, settings.ChannelID, message, payload)
+		if err != nil {
+			fmt.Println("✘ Error while updating the status message of "+serv.Nom+":", err)
+			messages[key] = message
+			continue
+		}
+		if messageID != message.MessageID || message.ChannelID != settings.ChannelID {
+			changed = true
+		}
+		message.ChannelID = settings.ChannelID
+		message.MessageID = messageID
+		messages[key] = message
+		lastPayloads[key] = string(payloadBytes)
+	}
+
+	if changed {
+		if err := saveMessages(); err != nil {
+			fmt.Println("✘ Error while saving the status messages:", err)
+		}
+	}
+}
+
+// sendStatusMessage edits the message of a server, or sends and pins a new one if it was deleted, and returns its ID
+func sendStatusMessage(botToken string, channelID string, message statusMessage, payload map[string]interface{}) (string, error) {
+	if message.MessageID != "" && message.ChannelID == channelID {
+		_, err := discord.DefaultClient.Do("PATCH", "/channels/"+channelID+"/messages/"+message.MessageID, botToken, payload)
+		var apiErr *discord.APIError
+		if err == nil {
+			return message.MessageID, nil
+		} else if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return "", err
+		}
+		fmt.Println("♟ Status message " + message.MessageID + " was deleted, sending a new one.")
+	}
+
+	body, err := discord.DefaultClient.Do("POST", "/channels/"+channelID+"/messages", botToken, payload)
+	if err != nil {
+		return "", err
+	}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &sent); err != nil || sent.ID == "" {
+		return "", fmt.Errorf("ERROR WHILE READING SENT STATUS MESSAGE: %s", body)
+	}
+
+	// The message is still edited if it can't be pinned, the bot only lacks the Manage Messages permission
+	if _, err := discord.DefaultClient.Do("PUT", "/channels/"+channelID+"/pins/"+sent.ID, botToken, nil); err != nil {
+		fmt.Println("✘ Error while pinning the status message:", err)
+	}
+	return sent.ID, nil
+}
+
+// statusPayload creates the embed of a server
+// The times use the Discord timestamps, so the uptime stays right between two edits
+func statusPayload(serv models.Server, serverRoster roster.ServerRoster, lastStart time.Time) (map[string]interface{}, error) {
+	color := serv.EmbedColor
+	title := "🔴 " + serv.Nom + " est hors ligne"
+	description := "Le serveur " + serv.Jeu + " est hors ligne."
+	if serverRoster.Online {
+		title = "🟢 " + serv.Nom + " est en ligne"
+		description = "Le serveur " + serv.Jeu + " est en ligne !"
+	} else {
+		color = offlineColor
+	}
+	if serv.Description != "" {
+		description += "\n" + serv.Description
+	}
+
+	colorInt, err := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: INVALID COLOR FORMAT: %v", err)
+	}
+
+	version := serv.Jeu + " " + serv.Version
+	if serv.Modpack != "" {
+		modpack := serv.Modpack
+		if serv.ModpackURL != "" {
+			modpack = "[" + serv.Modpack + "](" + serv.ModpackURL + ")"
+		}
+		version += "\n" + modpack
+	}
+	fields := []map[string]interface{}{
+		{"name": "Version", "value": strings.TrimSpace(version), "inline": true},
+	}
+
+	if serverRoster.Online {
+		players := "Aucun joueur connecté"
+		if len(serverRoster.Players) > 0 {
+			players = strings.Join(serverRoster.Players, ", ")
+		}
+		fields = append(fields, map[string]interface{}{
+			"name":   fmt.Sprintf("Joueurs (%d)", len(serverRoster.Players)),
+			"value":  truncate(players, 1024),
+			"inline": true,
+		})
+		if !serverRoster.OnlineSince.IsZero() {
+			fields = append(fields, map[string]interface{}{
+				"name":   "En ligne depuis",
+				"value":  fmt.Sprintf("<t:%d:R>", serverRoster.OnlineSince.Unix()),
+				"inline": true,
+			})
+		}
+	}
+	if !lastStart.IsZero() {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Dernier démarrage",
+			"value":  fmt.Sprintf("<t:%d:f>", lastStart.Unix()),
+			"inline": true,
+		})
+	}
+
+	embed := map[string]interface{}{
+		"title":       title,
+		"description": description,
+		"color":       colorInt,
+		"fields":      fields,
+	}
+	if serv.Image != "" {
+		embed["thumbnail"] = map[string]string{"url": serv.Image}
+	}
+	return map[string]interface{}{
+		"content": "",
+		"embeds":  []map[string]interface{}{embed},
+	}, nil
+}
+
+// truncate cuts a text to the length allowed by Discord
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// loadMessages reads the messages file
+func loadMessages() error {
+	content, err := os.ReadFile(config.AppConfig.StatusMessage.MessagesFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ERROR WHILE READING STATUS MESSAGES FILE %s: %v", config.AppConfig.StatusMessage.MessagesFile, err)
+	}
+	if err := json.Unmarshal(content, &messages); err != nil {
+		return fmt.Errorf("ERROR WHILE DECODING STATUS MESSAGES FILE %s: %v", config.AppConfig.StatusMessage.MessagesFile, err)
+	}
+	return nil
+}
+
+// saveMessages writes the messages file
+func saveMessages() error {
+	content, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE ENCODING STATUS MESSAGES: %v", err)
+	}
+
+	// Write in a temporary file first, so a crash never leaves a half written file
+	path := config.AppConfig.StatusMessage.MessagesFile
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING STATUS MESSAGES FILE: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("ERROR WHILE WRITING STATUS MESSAGES FILE: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package tmux
+
+// This file contains the control of the tmux sessions running the servers
+// The output of each session is piped to the log file of its server, so the daemon reads it like any other log file
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/console"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+// Session is a tmux session
+type Session struct {
+	Name     string
+	Created  time.Time
+	Attached bool // A terminal is attached to the session
+}
+
+var invalidSessionCharsRegex = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// run runs a tmux command and returns its output
+func run(args ...string) (string, error) {
+	output, err := exec.Command("tmux", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tmux %s failed: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// target returns the target of the first pane of a session, the "=" prefix makes tmux match the exact name
+func target(name string) string {
+	return "=" + name + ":"
+}
+
+// SessionName returns the name of the tmux session of a server
+func SessionName(server models.ServerConfig) string {
+	if server.TmuxSession != "" {
+		return server.TmuxSession
+	}
+	// tmux doesn't accept "." and ":" in the session names
+	return "serversentinel-" + invalidSessionCharsRegex.ReplaceAllString(server.Name, "_")
+}
+
+// NewSession creates a detached session running a command in a directory
+func NewSession(name string, workDir string, command string) error {
+	args := []string{"new-session", "-d", "-s", name}
+	if workDir != "" {
+		args = append(args, "-c", workDir)
+	}
+	_, err := run(append(args, command)...)
+	return err
+}
+
+// HasSession returns true if a session exists
+func HasSession(name string) bool {
+	_, err := run("has-session", "-t", "="+name)
+	return err == nil
+}
+
+// PipePane appends the output of a session to a file
+func PipePane(name string, filePath string) error {
+	_, err := run("pipe-pane", "-o", "-t", target(name), "cat >> "+shellQuote(filePath))
+	return err
+}
+
+// SendKeys types a line in a session and presses Enter
+func SendKeys(name string, line string) error {
+	// -l sends the text as is, so a word like "Enter" in the line isn't read as a key
+	if _, err := run("send-keys", "-t", target(name), "-l", line); err != nil {
+		return err
+	}
+	_, err := run("send-keys", "-t", target(name), "Enter")
+	return err
+}
+
+// CapturePane returns the last lines shown in a session
+func CapturePane(name string, lines int) (string, error) {
+	output, err := run("capture-pane", "-p", "-J", "-t", target(name), "-S", "-"+strconv.Itoa(lines))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(output, "\n"), nil
+}
+
+// ListSessions returns the running sessions
+func ListSessions() ([]Session, error) {
+	output, err := run("list-sessions", "-F", "#{session_name}\t#{session_created}\t#{session_attached}")
+	if err != nil {
+		if strings.Contains(err.Error(), "no server running") || strings.Contains(err.Error(), "error connecting") {
+			return nil, nil // No session at all
+		}
+		return nil, err
+	}
+	return parseSessions(output), nil
+}
+
+// parseSessions reads the output of list-sessions
+func parseSessions(output string) []Session {
+	var sessions []Session
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		created, _ := strconv.ParseInt(fields[1], 10, 64)
+		sessions = append(sessions, Session{
+			Name:     fields[0],
+			Created:  time.Unix(created, 0),
+			Attached: fields[2] != "0",
+		})
+	}
+	return sessions
+}
+
+// KillSession kills a session and the processes running in it
+func KillSession(name string) error {
+	_, err := run("kill-session", "-t", "="+name)
+	return err
+}
+
+// StartServer creates the session of a server with its start command, and pipes its output to its log file
+func StartServer(server models.ServerConfig) error {
+	if server.StartCommand == "" {
+		return fmt.Errorf("ERROR: NO START COMMAND SET FOR SERVER %s", server.Name)
+	}
+	name := SessionName(server)
+	if HasSession(name) {
+		return fmt.Errorf("ERROR: SESSION %s OF SERVER %s IS ALREADY RUNNING", name, server.Name)
+	}
+
+	if err := NewSession(name, server.WorkDir, server.StartCommand); err != nil {
+		return fmt.Errorf("ERROR WHILE CREATING SESSION OF SERVER %s: %v", server.Name, err)
+	}
+	if err := PipePane(name, console.LogFilePath(server)); err != nil {
+		return fmt.Errorf("ERROR WHILE PIPING SESSION OF SERVER %s TO ITS LOG FILE: %v", server.Name, err)
+	}
+	return nil
+}
+
+// StopServer types the stop command of a server in its session, and kills the session if it is still running after the delay
+func StopServer(server models.ServerConfig, delay time.Duration) error {
+	name := SessionName(server)
+	if !HasSession(name) {
+		return nil
+	}
+
+	if server.StopCommand != "" {
+		if err := SendKeys(name, server.StopCommand); err != nil {
+			return fmt.Errorf("ERROR WHILE STOPPING SERVER %s: %v", server.Name, err)
+		}
+		for deadline := time.Now().Add(delay); time.Now().Before(deadline); time.Sleep(time.Second) {
+			if !HasSession(name) {
+				return nil // The session ends with the server
+			}
+		}
+	}
+
+	if err := KillSession(name); err != nil && HasSession(name) {
+		return fmt.Errorf("ERROR WHILE KILLING SESSION OF SERVER %s: %v", server.Name, err)
+	}
+	return nil
+}
+
+// shellQuote quotes a text for the shell running the pipe-pane command
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
@@ -0,0 +1,107 @@
+package tmux
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+func TestSessionName(t *testing.T) {
+	if got := SessionName(models.ServerConfig{Name: "mc.vanilla:1"}); got != "serversentinel-mc_vanilla_1" {
+		t.Errorf("SessionName() = %q", got)
+	}
+	if got := SessionName(models.ServerConfig{Name: "primary", TmuxSession: "vanilla"}); got != "vanilla" {
+		t.Errorf("SessionName() with a session set = %q", got)
+	}
+}
+
+func TestParseSessions(t *testing.T) {
+	sessions := parseSessions("serversentinel-primary\t1736704800\t0\nadmin\t1736704900\t1\n")
+	if len(sessions) != 2 {
+		t.Fatalf("parseSessions() = %+v", sessions)
+	}
+	if sessions[0].Name != "serversentinel-primary" || sessions[0].Attached || !sessions[0].Created.Equal(time.Unix(1736704800, 0)) {
+		t.Errorf("first session = %+v", sessions[0])
+	}
+	if sessions[1].Name != "admin" || !sessions[1].Attached {
+		t.Errorf("second session = %+v", sessions[1])
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("/opt/logs/it's.log"); got != `'/opt/logs/it'\''s.log'` {
+		t.Errorf("shellQuote() = %s", got)
+	}
+}
+
+// TestServerSession runs a fake server in a tmux server of its own
+func TestServerSession(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("TMUX", "")
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "test.log")
+	server := models.ServerConfig{
+		Name:         "test",
+		LogFile:      logFile,
+		WorkDir:      dir,
+		StartCommand: `sh -c 'echo "Server started"; while read line; do echo "> $line"; [ "$line" = stop ] && exit 0; done'`,
+		StopCommand:  "stop",
+	}
+	name := SessionName(server)
+	t.Cleanup(func() { KillSession(name) })
+
+	if sessions, err := ListSessions(); err != nil || len(sessions) != 0 {
+		t.Fatalf("ListSessions() without tmux server = %v, %v", sessions, err)
+	}
+
+	if err := StartServer(server); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartServer(server); err == nil {
+		t.Error("StartServer() of a running server returned no error")
+	}
+
+	sessions, err := ListSessions()
+	if err != nil || len(sessions) != 1 || sessions[0].Name != name {
+		t.Fatalf("ListSessions() = %+v, %v", sessions, err)
+	}
+
+	if err := SendKeys(name, "say Enter the world"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		pane, _ := CapturePane(name, 50)
+		return strings.Contains(pane, "> say Enter the world")
+	})
+	waitFor(t, func() bool {
+		content, _ := os.ReadFile(logFile)
+		return strings.Contains(string(content), "> say Enter the world")
+	})
+
+	if err := StopServer(server, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if HasSession(name) {
+		t.Error("session still running after StopServer()")
+	}
+}
+
+// waitFor waits until condition returns true
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatal("condition not met before the timeout")
+}
@@ -3,17 +3,19 @@ package triggers
 // This file contains the ACTIONS functions for the triggers
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/crashreport"
 	"github.com/Corentin-cott/ServerSentinel/internal/db"
-	"github.com/Corentin-cott/ServerSentinel/internal/discord"
 	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+	"github.com/Corentin-cott/ServerSentinel/internal/recovery"
+	"github.com/Corentin-cott/ServerSentinel/internal/roster"
 	"github.com/Corentin-cott/ServerSentinel/internal/services"
 )
 
@@ -34,31 +36,66 @@ func WriteToLogFile(logPath string, line string) error {
 	return nil
 }
 
-func SendToDiscordWebhook(serverType string, message string) error {
-	// fmt.Println("Sending message to Discord webhook for server type:", serverType)
-	webhookURL := config.AppConfig.DiscordWebhooks[serverType].URL
-	if webhookURL == "" {
-		return fmt.Errorf("ERROR: WEBHOOK URL FOR SERVER TYPE %s NOT FOUND", serverType)
+// SendToDiscordWebhook queues a message for the webhook of a registered server
+func SendToDiscordWebhook(server models.ServerConfig, message string) error {
+	if config.AppConfig.DiscordWebhooks[server.Webhook].URL == "" {
+		return fmt.Errorf("ERROR: WEBHOOK URL FOR SERVER %s NOT FOUND", server.Name)
 	}
 
-	payload := map[string]string{
-		"content": message,
+	err := outbox.SendWebhook(server.Webhook, message)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SENDING DISCORD WEBHOOK: %v", err)
+	}
+
+	return nil
+}
+
+// sendToBridgeGroup shows a message on the other servers of the bridge group of a server, with the tag of the server before it
+// A server that can't be reached doesn't stop the message from being sent to the others
+func sendToBridgeGroup(serverID int, server models.Server, components ...services.TextComponent) error {
+	sourceServer, exists := db.GetServerConfigById(serverID)
+	if !exists {
+		return fmt.Errorf("ERROR: SERVER %d IS NOT IN THE SERVER REGISTRY", serverID)
+	}
+	if config.GetBridgeGroup(sourceServer) == "" {
+		return nil // The server doesn't share its chat
 	}
-	jsonPayload, err := json.Marshal(payload)
+
+	targets, err := db.GetBridgeTargets(sourceServer)
 	if err != nil {
-		return fmt.Errorf("ERROR MARSHALING DISCORD PAYLOAD: %v", err)
+		return fmt.Errorf("ERROR WHILE GETTING RCON PARAMETERS: %v", err)
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
+	if sourceServer.BridgeTag != "" {
+		components = append([]services.TextComponent{services.Text(sourceServer.BridgeTag + " ").WithColor(server.EmbedColor)}, components...)
+	}
+	command, err := services.TellrawCommand("@a", components...)
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE SENDING DISCORD WEBHOOK: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("DISCORD WEBHOOK RETURNED NON-2XX STATUS: %d", resp.StatusCode)
+	var failures []string
+	for _, target := range targets {
+		switch target.Server.Jeu {
+		case "Minecraft":
+			resp, err := services.SendRconToMinecraftServer(target.RconHost, target.RconPort, target.RconPassword, command)
+			if err != nil {
+				failures = append(failures, target.Config.Name+": "+err.Error())
+				continue
+			}
+			fmt.Println("RCON response from Minecraft server "+target.Config.Name+":", resp)
+		case "Palworld":
+			// Palworld has no text components, the message is announced as plain text
+			err := db.GetPalworldClient(target.Config).Announce(services.PlainText(components...))
+			if err != nil {
+				failures = append(failures, target.Config.Name+": "+err.Error())
+			}
+		}
 	}
 
+	if len(failures) > 0 {
+		return fmt.Errorf("ERROR WHILE SENDING MESSAGE TO BRIDGED SERVERS: %s", strings.Join(failures, ", "))
+	}
 	return nil
 }
 
@@ -139,26 +176,15 @@ func PlayerMessageAction(line string, serverID int) error {
 		Footer:      "Message venant de " + server.Nom,
 	}
 
-	err = discord.SendDiscordEmbedWithModel(config.AppConfig.Bots[botName], config.AppConfig.DiscordChannels.MinecraftChatChannelID, embed)
+	err = outbox.SendDiscordEmbedWithModel(botName, config.AppConfig.DiscordChannels.MinecraftChatChannelID, embed)
 	if err != nil {
 		return fmt.Errorf("ERROR WHILE SENDING DISCORD EMBED: %v", err)
 	}
 
-	/* Let's now send the message to the secondary Server */
-	// We first need to know if the server is primary or secondary
-	serverToSend, serverToSendHost, serverToSendRconPort, serverToSendRconPassword, err := db.GetRconParameters(server.Type)
-
-	// Now we can send the message to the server
-	if serverToSend.Jeu == "Minecraft" {
-		command := `tellraw @a ["",{"text":"<` + playerName + `>","color":"` + server.EmbedColor + `"},{"text":" `+ message + `"}]`
-		fmt.Println("RCON parameters:", serverToSendHost, serverToSendRconPort, serverToSendRconPassword)
-		resp, err := services.SendRconToMinecraftServer(serverToSendHost, serverToSendRconPort, serverToSendRconPassword, command)
-		if err != nil {
-			return fmt.Errorf("ERROR WHILE SENDING RCON COMMAND TO MINECRAFT SERVER: %v", err)
-		}
-		fmt.Println("RCON response from Minecraft server:", resp)
-	} else if serverToSend.Jeu == "Palworld" {
-		// Not implemented yet
+	/* Let's now send the message to the other servers of the bridge group */
+	err = sendToBridgeGroup(serverID, server, services.Text("<"+playerName+">").WithColor(server.EmbedColor), services.Text(" "+message))
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -190,6 +216,151 @@ var gameJoinActionsMap = map[string]func(string) (string, error){
 	"Palworld":  handlePalworldPlayerJoined,
 }
 
+// resolvePlayerID returns the ID of a player in the database, inserting the player if needed
+func resolvePlayerID(line string, playerName string, server models.Server) (int, error) {
+	switch server.Jeu {
+	case "Palworld":
+		// Palworld players are identified by the user ID written in the join and leave lines
+		userID, err := services.ParsePalworldUserID(line)
+		if err != nil {
+			return -1, err
+		}
+		return db.CheckAndInsertPlayerWithPlayerUUID(userID, server.ID, "now")
+	default:
+		return db.CheckAndInsertPlayerWithPlayerName(playerName, server.ID, "now")
+	}
+}
+
+// findPlayerID returns the ID of a player who left a server, or -1 if they aren't known
+// Unlike resolvePlayerID, it never inserts the player nor calls an outside API
+func findPlayerID(line string, playerName string, server models.Server) (int, error) {
+	switch server.Jeu {
+	case "Palworld":
+		userID, err := services.ParsePalworldUserID(line)
+		if err != nil {
+			return -1, err
+		}
+		return db.FindPlayerIdByAccountId(userID)
+	default:
+		// The Minecraft leave lines only hold the name of the player, it was saved in their session when they joined
+		return db.GetOpenSessionPlayerId(server.ID, playerName)
+	}
+}
+
+// savePlayerConnection adds a player to the roster, saves their connection in the database and in the log file, and opens their session, all at the time they joined
+func savePlayerConnection(line string, playerName string, server models.Server, joinedAt time.Time) error {
+	roster.PlayerJoined(server.ID, playerName)
+
+	playerID, err := resolvePlayerID(line, playerName, server)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE CHECKING OR INSERTING PLAYER: %v", err)
+	}
+
+	connectedAt := db.ToGoodDatetime(joinedAt)
+	err = db.SaveConnectionLog(playerID, server.ID, connectedAt)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE SAVING CONNECTION LOG: FOR PLAYER %v IN DATABASE: %v", playerName, err)
+	}
+
+	err = db.UpdatePlayerLastConnection(playerID, connectedAt)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE UPDATING LAST CONNECTION FOR PLAYER %v IN DATABASE: %v", playerName, err)
+	}
+
+	err = db.OpenPlayerSession(playerID, server.ID, playerName, joinedAt)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE OPENING SESSION FOR PLAYER %v: %v", playerName, err)
+	}
+
+	// Log to file
+	WriteToLogFile("/var/log/serversentinel/playerjoined.log", playerName)
+	return nil
+}
+
+// closePlayerSession removes a player who left a server from the roster and closes their session at the time they left
+func closePlayerSession(line string, playerName string, server models.Server, leftAt time.Time) error {
+	roster.PlayerLeft(server.ID, playerName)
+
+	playerID, err := findPlayerID(line, playerName, server)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE GETTING PLAYER FOR SESSION: %v", err)
+	}
+	if playerID == -1 {
+		return nil // The player has no session to close
+	}
+
+	err = db.ClosePlayerSession(playerID, server.ID, leftAt)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE CLOSING SESSION FOR PLAYER %v: %v", playerName, err)
+	}
+	return nil
+}
+
+// ServerStartedAction marks a server as online in the roster and in the recovery, and closes the sessions still open on it at the time it started
+// Nobody is connected to a server that just started, those sessions lost their leave or stop line, like when the log file rotated while the daemon was stopped
+func ServerStartedAction(serverID int, startedAt time.Time) {
+	closed, err := db.CloseServerSessions(serverID, startedAt)
+	if err != nil {
+		fmt.Println("ERROR WHILE CLOSING SERVER SESSIONS: " + err.Error())
+	} else if closed > 0 {
+		fmt.Printf("♟ %d player sessions left open were closed when server %d started.\n", closed, serverID)
+	}
+
+	roster.ServerStarted(serverID)
+	recovery.ServerStarted(serverID)
+}
+
+// ServerCleanlyStoppedAction closes the sessions of a server that wrote its stopping line, so its restart policy knows it didn't crash
+func ServerCleanlyStoppedAction(serverID int, stoppedAt time.Time) {
+	ServerStoppedAction(serverID, stoppedAt)
+	recovery.ServerStopped(serverID)
+}
+
+// ServerCrashedAction closes the sessions of a crashed server, posts its crash report, and restarts it if its restart policy allows it
+func ServerCrashedAction(serverID int) {
+	ServerStoppedAction(serverID, time.Now())
+	go func() {
+		if err := crashreport.Capture(serverID); err != nil {
+			fmt.Println("✘ Error while capturing the crash report:", err)
+		}
+	}()
+	recovery.ServerCrashed(serverID)
+}
+
+// ServerStoppedAction empties the roster of a server that stopped or crashed and closes the sessions of its players at the time it stopped
+func ServerStoppedAction(serverID int, stoppedAt time.Time) {
+	roster.ServerStopped(serverID)
+
+	closed, err := db.CloseServerSessions(serverID, stoppedAt)
+	if err != nil {
+		fmt.Println("ERROR WHILE CLOSING SERVER SESSIONS: " + err.Error())
+		return
+	}
+	if closed > 0 {
+		fmt.Printf("♟ %d player sessions closed on server %d.\n", closed, serverID)
+	}
+}
+
+// Action when a player joined the server while the daemon was stopped, only the database is updated
+func PlayerJoinedCatchUpAction(line string, serverID int, joinedAt time.Time) error {
+	server, err := db.GetServerById(serverID)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE GETTING SERVER BY ID FOR PLAYER JOINED: %v", err)
+	}
+
+	actionFunc, exists := gameJoinActionsMap[server.Jeu]
+	if !exists {
+		return fmt.Errorf("ERROR: SERVER GAME %v IS NOT SUPPORTED", server.Jeu)
+	}
+
+	playerName, err := actionFunc(line)
+	if err != nil {
+		return err
+	}
+
+	return savePlayerConnection(line, playerName, server, joinedAt)
+}
+
 // Action when a player joined the server
 func PlayerJoinedAction(line string, serverID int) error {
 	// Server infos
@@ -219,42 +390,18 @@ func PlayerJoinedAction(line string, serverID int) error {
 	}
 
 	// Send the Discord embed message
-	discord.SendDiscordEmbed(config.AppConfig.Bots[botName], config.AppConfig.DiscordChannels.MinecraftChatChannelID, playerName+" a rejoint "+server.Nom, "", server.EmbedColor)
+	outbox.SendDiscordEmbed(botName, config.AppConfig.DiscordChannels.MinecraftChatChannelID, playerName+" a rejoint "+server.Nom, "", server.EmbedColor)
 
 	// Handle player connection log in DB
-	playerID, err := db.CheckAndInsertPlayerWithPlayerName(playerName, 1, "now")
+	err = savePlayerConnection(line, playerName, server, time.Now())
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE CHECKING OR INSERTING PLAYER: %v", err)
-	}
-
-	err = db.SaveConnectionLog(playerID, serverID)
-	if err != nil {
-		return fmt.Errorf("ERROR WHILE SAVING CONNECTION LOG: FOR PLAYER %v IN DATABASE: %v", playerName, err)
+		return err
 	}
 
-	err = db.UpdatePlayerLastConnection(playerID)
+	/* Let's now send the message to the other servers of the bridge group */
+	err = sendToBridgeGroup(serverID, server, services.Text(playerName+" a rejoint le serveur "+server.Nom).WithColor("yellow"))
 	if err != nil {
-		return fmt.Errorf("ERROR WHILE UPDATING LAST CONNECTION FOR PLAYER %v IN DATABASE: %v", playerName, err)
-	}
-
-	// Log to file
-	WriteToLogFile("/var/log/serversentinel/playerjoined.log", playerName)
-
-		/* Let's now send the message to the secondary Server */
-	// We first need to know if the server is primary or secondary
-	serverToSend, serverToSendHost, serverToSendRconPort, serverToSendRconPassword, err := db.GetRconParameters(server.Type)
-
-	// Now we can send the message to the server
-	if serverToSend.Jeu == "Minecraft" {
-		command := `tellraw @a {"text":"` + playerName + ` a rejoint le serveur ` + server.Nom + `","color":"yellow"}`
-		fmt.Println("RCON parameters:", serverToSendHost, serverToSendRconPort, serverToSendRconPassword)
-		resp, err := services.SendRconToMinecraftServer(serverToSendHost, serverToSendRconPort, serverToSendRconPassword, command)
-		if err != nil {
-			return fmt.Errorf("ERROR WHILE SENDING RCON COMMAND TO MINECRAFT SERVER: %v", err)
-		}
-		fmt.Println("RCON response from Minecraft server:", resp)
-	} else if serverToSend.Jeu == "Palworld" {
-		// Not implemented yet
+		return err
 	}
 
 	return nil
@@ -294,7 +441,7 @@ func PlayerGetAdvancementAction(line string, serverID int) error {
 	}
 
 	// Send the Discord embed message
-	err = discord.SendDiscordEmbedWithModel(config.AppConfig.Bots[botName], config.AppConfig.DiscordChannels.MinecraftChatChannelID, embed)
+	err = outbox.SendDiscordEmbedWithModel(botName, config.AppConfig.DiscordChannels.MinecraftChatChannelID, embed)
 	if err != nil {
 		return fmt.Errorf("ERROR WHILE SENDING DISCORD EMBED: %v", err)
 	}
@@ -325,7 +472,7 @@ func PlayerDeathAction(deathMessage string, playername string, serverID int) err
 		AuthorIcon:  "",
 		Timestamp:   true,
 	}
-	err = discord.SendDiscordEmbedWithModel(config.AppConfig.Bots[botName], config.AppConfig.DiscordChannels.MinecraftChatChannelID, embedtwo)
+	err = outbox.SendDiscordEmbedWithModel(botName, config.AppConfig.DiscordChannels.MinecraftChatChannelID, embedtwo)
 	if err != nil {
 		return fmt.Errorf("ERROR WHILE SENDING DISCORD EMBED: %v", err)
 	}
@@ -359,6 +506,26 @@ var gameLeaveActionsMap = map[string]func(string) (string, error){
 	"Palworld":  handlePalworldPlayerLeft,
 }
 
+// Action when a player left the server while the daemon was stopped, only the session is closed
+func PlayerLeftCatchUpAction(line string, serverID int, leftAt time.Time) error {
+	server, err := db.GetServerById(serverID)
+	if err != nil {
+		return fmt.Errorf("ERROR WHILE GETTING SERVER BY ID FOR PLAYER LEFT: %v", err)
+	}
+
+	actionFunc, exists := gameLeaveActionsMap[server.Jeu]
+	if !exists {
+		return fmt.Errorf("ERROR: SERVER GAME %v IS NOT SUPPORTED", server.Jeu)
+	}
+
+	playerName, err := actionFunc(line)
+	if err != nil {
+		return err
+	}
+
+	return closePlayerSession(line, playerName, server, leftAt)
+}
+
 // Action when a player left the server
 func PlayerLeftAction(line string, serverID int) error {
 	// Server infos
@@ -388,26 +555,21 @@ func PlayerLeftAction(line string, serverID int) error {
 	}
 
 	// Send the Discord embed message
-	discord.SendDiscordEmbed(config.AppConfig.Bots[botName], config.AppConfig.DiscordChannels.MinecraftChatChannelID, playerName+" a quitté "+server.Nom, "", server.EmbedColor)
+	outbox.SendDiscordEmbed(botName, config.AppConfig.DiscordChannels.MinecraftChatChannelID, playerName+" a quitté "+server.Nom, "", server.EmbedColor)
+
+	// Close the session of the player
+	err = closePlayerSession(line, playerName, server, time.Now())
+	if err != nil {
+		fmt.Println(err)
+	}
 
 	// Log to file
 	WriteToLogFile("/var/log/serversentinel/playerdisconnected.log", playerName)
 
-	/* Let's now send the message to the secondary Server */
-	// We first need to know if the server is primary or secondary
-	serverToSend, serverToSendHost, serverToSendRconPort, serverToSendRconPassword, err := db.GetRconParameters(server.Type)
-
-	// Now we can send the message to the server
-	if serverToSend.Jeu == "Minecraft" {
-		command := `tellraw @a {"text":"` + playerName + ` a quitté le serveur ` + server.Nom + `","color":"yellow"}`
-		fmt.Println("RCON parameters:", serverToSendHost, serverToSendRconPort, serverToSendRconPassword)
-		resp, err := services.SendRconToMinecraftServer(serverToSendHost, serverToSendRconPort, serverToSendRconPassword, command)
-		if err != nil {
-			return fmt.Errorf("ERROR WHILE SENDING RCON COMMAND TO MINECRAFT SERVER: %v", err)
-		}
-		fmt.Println("RCON response from Minecraft server:", resp)
-	} else if serverToSend.Jeu == "Palworld" {
-		// Not implemented yet
+	/* Let's now send the message to the other servers of the bridge group */
+	err = sendToBridgeGroup(serverID, server, services.Text(playerName+" a quitté le serveur "+server.Nom).WithColor("yellow"))
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,313 @@
+package triggers
+
+// This file contains the triggers declared in the rules file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/Corentin-cott/ServerSentinel/config"
+	"github.com/Corentin-cott/ServerSentinel/internal/db"
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
+	"github.com/Corentin-cott/ServerSentinel/internal/services"
+)
+
+// rconEscaper removes from the values given to an rcon command the characters that change a Minecraft command
+// A chat line could otherwise add a selector (@a), a JSON text or NBT data ({...}, [...], "...") or formatting codes to the command
+var rconEscaper = strings.NewReplacer("@", "", "\"", "", "\\", "", "{", "", "}", "", "[", "", "]", "", "§", "")
+
+// compiledRuleAction is a rule action with its templates parsed
+type compiledRuleAction struct {
+	action    models.TriggerRuleAction
+	templates map[string]*template.Template
+	args      []*template.Template
+}
+
+// LoadRuleTriggers loads the triggers declared in the rules file
+// A bad rule is reported and skipped, it doesn't prevent the other rules from loading
+func LoadRuleTriggers(rulesPath string) ([]models.Trigger, error) {
+	if rulesPath == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR WHILE READING RULES FILE %s: %v", rulesPath, err)
+	}
+
+	var rules []models.TriggerRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("ERROR WHILE DECODING RULES FILE %s: %v", rulesPath, err)
+	}
+
+	var ruleTriggers []models.Trigger
+	for i, rule := range rules {
+		trigger, err := compileRule(rule)
+		if err != nil {
+			fmt.Printf("✘ Rule #%d (%s) ignored: %v\n", i+1, rule.Name, err)
+			continue
+		}
+		ruleTriggers = append(ruleTriggers, trigger)
+	}
+
+	return ruleTriggers, nil
+}
+
+// compileRule checks a rule and turns it into a trigger
+func compileRule(rule models.TriggerRule) (models.Trigger, error) {
+	if rule.Name == "" {
+		return models.Trigger{}, fmt.Errorf("RULE NAME IS EMPTY")
+	}
+
+	regex, err := regexp.Compile(rule.Regex)
+	if err != nil {
+		return models.Trigger{}, fmt.Errorf("INVALID REGEX: %v", err)
+	}
+
+	if len(rule.Actions) == 0 {
+		return models.Trigger{}, fmt.Errorf("RULE HAS NO ACTION")
+	}
+
+	var actions []compiledRuleAction
+	for _, action := range rule.Actions {
+		compiled, err := compileRuleAction(rule.Name, action)
+		if err != nil {
+			return models.Trigger{}, err
+		}
+		actions = append(actions, compiled)
+	}
+
+	return models.Trigger{
+		Name: rule.Name,
+		Condition: func(line string) bool {
+			return regex.MatchString(line)
+		},
+		Action: func(line string, serverID int) {
+			data, ok := ruleTemplateData(rule, regex, line, serverID)
+			if !ok {
+				return
+			}
+			for _, action := range actions {
+				if err := executeRuleAction(action, data, serverID); err != nil {
+					fmt.Println("ERROR WHILE EXECUTING " + action.action.Type + " ACTION OF RULE " + rule.Name + ": " + err.Error())
+				}
+			}
+		},
+		CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+			data, ok := ruleTemplateData(rule, regex, line, serverID)
+			if !ok {
+				return
+			}
+			// Old lines only update the database and the log files
+			for _, action := range actions {
+				if action.action.Type != "db" && action.action.Type != "logFile" {
+					continue
+				}
+				if err := executeRuleAction(action, data, serverID); err != nil {
+					fmt.Println("ERROR WHILE EXECUTING " + action.action.Type + " ACTION OF RULE " + rule.Name + ": " + err.Error())
+				}
+			}
+		},
+	}, nil
+}
+
+// compileRuleAction checks an action and parses its templates
+func compileRuleAction(ruleName string, action models.TriggerRuleAction) (compiledRuleAction, error) {
+	var fields map[string]string
+	switch action.Type {
+	case "discordEmbed":
+		if action.Bot == "" || action.Channel == "" {
+			return compiledRuleAction{}, fmt.Errorf("DISCORD EMBED ACTION NEEDS A BOT AND A CHANNEL")
+		}
+		fields = map[string]string{"title": action.Title, "description": action.Description}
+	case "webhook":
+		fields = map[string]string{"content": action.Content}
+	case "rcon":
+		if action.Command == "" {
+			return compiledRuleAction{}, fmt.Errorf("RCON ACTION NEEDS A COMMAND")
+		}
+		fields = map[string]string{"command": action.Command}
+	case "db":
+		if action.Query == "" {
+			return compiledRuleAction{}, fmt.Errorf("DB ACTION NEEDS A QUERY")
+		}
+	case "logFile":
+		if action.Path == "" {
+			return compiledRuleAction{}, fmt.Errorf("LOG FILE ACTION NEEDS A PATH")
+		}
+		fields = map[string]string{"line": action.Line}
+	default:
+		return compiledRuleAction{}, fmt.Errorf("UNKNOWN ACTION TYPE: %s", action.Type)
+	}
+
+	compiled := compiledRuleAction{action: action, templates: map[string]*template.Template{}}
+	for field, text := range fields {
+		tmpl, err := template.New(ruleName + "." + field).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return compiledRuleAction{}, fmt.Errorf("INVALID TEMPLATE IN %s: %v", field, err)
+		}
+		compiled.templates[field] = tmpl
+	}
+	for i, arg := range action.Args {
+		tmpl, err := template.New(ruleName + ".args." + strconv.Itoa(i)).Option("missingkey=zero").Parse(arg)
+		if err != nil {
+			return compiledRuleAction{}, fmt.Errorf("INVALID TEMPLATE IN ARG %d: %v", i, err)
+		}
+		compiled.args = append(compiled.args, tmpl)
+	}
+
+	return compiled, nil
+}
+
+// ruleTemplateData checks the game and server filters of a rule and builds the data given to the templates
+func ruleTemplateData(rule models.TriggerRule, regex *regexp.Regexp, line string, serverID int) (map[string]string, bool) {
+	server, _ := db.GetServerConfigById(serverID)
+	if len(rule.Servers) > 0 && !slices.Contains(rule.Servers, server.Name) {
+		return nil, false
+	}
+
+	game := server.Game
+	serverName := server.Name
+	if serv, err := db.GetServerById(serverID); err == nil {
+		game = serv.Jeu
+		serverName = serv.Nom
+	}
+	if len(rule.Games) > 0 && !slices.Contains(rule.Games, game) {
+		return nil, false
+	}
+
+	data := map[string]string{
+		"line":       line,
+		"server":     serverName,
+		"serverID":   strconv.Itoa(serverID),
+		"game":       game,
+		"sourceName": server.Name,
+	}
+	matches := regex.FindStringSubmatch(line)
+	for i, name := range regex.SubexpNames() {
+		if name != "" && i < len(matches) {
+			data[name] = matches[i]
+		}
+	}
+
+	return data, true
+}
+
+// renderRuleTemplate executes a parsed template with the rule data
+func renderRuleTemplate(tmpl *template.Template, data map[string]string) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("ERROR WHILE EXECUTING TEMPLATE %s: %v", tmpl.Name(), err)
+	}
+	return buffer.String(), nil
+}
+
+// ruleChannelID returns the ID of a channel named in a rule, or the value itself if it's already an ID
+func ruleChannelID(channel string) string {
+	channels := config.AppConfig.DiscordChannels
+	switch channel {
+	case "botAdminChannelID":
+		return channels.BotAdminChannelID
+	case "serverStatusChannelID":
+		return channels.ServerStatusChannelID
+	case "minecraftChatChannelID":
+		return channels.MinecraftChatChannelID
+	case "palworldChatChannelID":
+		return channels.PalworldChatChannelID
+	}
+	return channel
+}
+
+// escapeRconData returns the template data with every value escaped for an rcon command, the text of the template itself is kept
+// The control characters are removed too, so a value can't add a second line to the command
+func escapeRconData(data map[string]string) map[string]string {
+	escaped := make(map[string]string, len(data))
+	for key, value := range data {
+		value = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, value)
+		escaped[key] = rconEscaper.Replace(value)
+	}
+	return escaped
+}
+
+// executeRuleAction executes a rule action
+func executeRuleAction(compiled compiledRuleAction, data map[string]string, serverID int) error {
+	action := compiled.action
+	templateData := data
+	if action.Type == "rcon" {
+		templateData = escapeRconData(data)
+	}
+	rendered := map[string]string{}
+	for field, tmpl := range compiled.templates {
+		text, err := renderRuleTemplate(tmpl, templateData)
+		if err != nil {
+			return err
+		}
+		rendered[field] = text
+	}
+
+	switch action.Type {
+	case "discordEmbed":
+		color := action.Color
+		if color == "" {
+			server, err := db.GetServerById(serverID)
+			if err != nil {
+				return fmt.Errorf("ERROR WHILE GETTING SERVER BY ID: %v", err)
+			}
+			color = server.EmbedColor
+		}
+		return outbox.SendDiscordEmbed(action.Bot, ruleChannelID(action.Channel), rendered["title"], rendered["description"], color)
+
+	case "webhook":
+		server, _ := db.GetServerConfigById(serverID)
+		if action.Webhook != "" {
+			server.Webhook = action.Webhook
+		}
+		return SendToDiscordWebhook(server, rendered["content"])
+
+	case "rcon":
+		server, exists := db.GetServerConfigById(serverID)
+		if action.Server != "" {
+			server, exists = config.GetServerConfigByName(action.Server)
+		}
+		if !exists {
+			return fmt.Errorf("ERROR: RCON TARGET SERVER IS NOT IN THE SERVER REGISTRY")
+		}
+		host, port, password := db.GetRconAddress(server)
+		_, err := services.SendRconToMinecraftServer(host, port, password, rendered["command"])
+		return err
+
+	case "db":
+		var args []any
+		for _, tmpl := range compiled.args {
+			arg, err := renderRuleTemplate(tmpl, data)
+			if err != nil {
+				return err
+			}
+			args = append(args, arg)
+		}
+		return db.ExecRuleQuery(action.Query, args...)
+
+	case "logFile":
+		return WriteToLogFile(action.Path, rendered["line"])
+	}
+
+	return nil
+}
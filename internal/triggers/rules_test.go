@@ -0,0 +1,33 @@
+package triggers
+
+import (
+	"testing"
+
+	"github.com/Corentin-cott/ServerSentinel/internal/models"
+)
+
+// TestRconCommandEscaping checks that a chat message captured by a rule can't change the rcon command it's used in
+func TestRconCommandEscaping(t *testing.T) {
+	compiled, err := compileRuleAction("test", models.TriggerRuleAction{Type: "rcon", Command: `tellraw @a {"text":"{{.player}} : {{.message}}"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"j'ai trouvé des diamants":        `tellraw @a {"text":"Steve : j'ai trouvé des diamants"}`,
+		`"},{"text":"x","clickEvent":{}}`: `tellraw @a {"text":"Steve : ,text:x,clickEvent:"}`,
+		"kill @e[type=!player]":           `tellraw @a {"text":"Steve : kill etype=!player"}`,
+		"salut\nop Steve\r":               `tellraw @a {"text":"Steve : salutop Steve"}`,
+		`§kcaché\"`:                       `tellraw @a {"text":"Steve : kcaché"}`,
+	}
+	for message, want := range tests {
+		data := escapeRconData(map[string]string{"player": "Steve", "message": message})
+		got, err := renderRuleTemplate(compiled.templates["command"], data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("message %q gave %s, want %s", message, got, want)
+		}
+	}
+}
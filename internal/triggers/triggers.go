@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Corentin-cott/ServerSentinel/config"
 	"github.com/Corentin-cott/ServerSentinel/internal/db"
-	"github.com/Corentin-cott/ServerSentinel/internal/discord"
 	"github.com/Corentin-cott/ServerSentinel/internal/models"
+	"github.com/Corentin-cott/ServerSentinel/internal/outbox"
 )
 
 // GetTriggers returns the list of triggers filtered by names
@@ -57,7 +58,11 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE GETTING SERVER BY ID FOR MINECRAFT SERVER STARTED: " + err.Error())
 					return
 				}
-				discord.SendDiscordEmbed(config.AppConfig.Bots["mineotterBot"], config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" viens d'ouvrir !", "Connectez-vous !\nLe serveur "+server.Jeu+" est en ligne !", server.EmbedColor)
+				outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" viens d'ouvrir !", "Connectez-vous !\nLe serveur "+server.Jeu+" est en ligne !", server.EmbedColor)
+				ServerStartedAction(serverID, time.Now())
+			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				ServerStartedAction(serverID, writtenAt)
 			},
 		},
 		{
@@ -77,7 +82,11 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE GETTING SERVER BY ID FOR MINECRAFT SERVER STOPPED: " + err.Error())
 					return
 				}
-				discord.SendDiscordEmbed(config.AppConfig.Bots["mineotterBot"], config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" viens de fermer !", "Le serveur "+server.Jeu+" est hors ligne !", server.EmbedColor)
+				outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" viens de fermer !", "Le serveur "+server.Jeu+" est hors ligne !", server.EmbedColor)
+				ServerCleanlyStoppedAction(serverID, time.Now())
+			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				ServerCleanlyStoppedAction(serverID, writtenAt)
 			},
 		},
 		{
@@ -97,7 +106,11 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE GETTING SERVER BY ID FOR MINECRAFT SERVER CRASHED: " + err.Error())
 					return
 				}
-				discord.SendDiscordEmbed(config.AppConfig.Bots["mineotterBot"], config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" vient de crash !", "Le serveur "+server.Jeu+" est hors ligne !", server.EmbedColor)
+				outbox.SendDiscordEmbed("mineotterBot", config.AppConfig.DiscordChannels.MinecraftChatChannelID, server.Nom+" vient de crash !", "Le serveur "+server.Jeu+" est hors ligne !", server.EmbedColor)
+				ServerCrashedAction(serverID)
+			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				ServerStoppedAction(serverID, writtenAt)
 			},
 		},
 		{
@@ -115,6 +128,12 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE PROCESSING PLAYER JOINED: " + err.Error())
 				}
 			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				err := PlayerJoinedCatchUpAction(line, serverID, writtenAt)
+				if err != nil {
+					fmt.Println("ERROR WHILE PROCESSING PLAYER JOINED: " + err.Error())
+				}
+			},
 		},
 		{
 			// This trigger is used to detect when a player disconnects from a Minecraft server
@@ -123,7 +142,7 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 				if isPlayerMessage(line) {
 					return false
 				}
-				return strings.Contains(line, "lost connection: Disconnected")
+				return strings.Contains(line, " lost connection: ") // Every disconnection, whatever its reason
 			},
 			Action: func(line string, serverID int) {
 				err := PlayerLeftAction(line, serverID)
@@ -131,6 +150,12 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE PROCESSING PLAYER DISCONNECTED: " + err.Error())
 				}
 			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				err := PlayerLeftCatchUpAction(line, serverID, writtenAt)
+				if err != nil {
+					fmt.Println("ERROR WHILE PROCESSING PLAYER DISCONNECTED: " + err.Error())
+				}
+			},
 		},
 		{
 			// This trigger is used to detect when a Minecraft Player get an advancement
@@ -185,7 +210,11 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE GETTING SERVER BY ID FOR MINECRAFT SERVER STARTED: " + err.Error())
 					return
 				}
-				discord.SendDiscordEmbed(config.AppConfig.Bots["multiloutreBot"], config.AppConfig.DiscordChannels.PalworldChatChannelID, server.Nom+" viens d'ouvrir !", "Connectez-vous !\nLe serveur "+server.Jeu+" est en ligne !", server.EmbedColor)
+				outbox.SendDiscordEmbed("multiloutreBot", config.AppConfig.DiscordChannels.PalworldChatChannelID, server.Nom+" viens d'ouvrir !", "Connectez-vous !\nLe serveur "+server.Jeu+" est en ligne !", server.EmbedColor)
+				ServerStartedAction(serverID, time.Now())
+			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				ServerStartedAction(serverID, writtenAt)
 			},
 		},
 		{
@@ -204,6 +233,12 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE PROCESSING PLAYER JOINED: " + err.Error())
 				}
 			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				err := PlayerJoinedCatchUpAction(line, serverID, writtenAt)
+				if err != nil {
+					fmt.Println("ERROR WHILE PROCESSING PLAYER JOINED: " + err.Error())
+				}
+			},
 		},
 		{
 			// This trigger is used to detect when a player disconnects from a Palworld server
@@ -220,6 +255,12 @@ func GetTriggers(selectedTriggers []string) []models.Trigger {
 					fmt.Println("ERROR WHILE PROCESSING PLAYER DISCONNECTED: " + err.Error())
 				}
 			},
+			CatchUpAction: func(line string, serverID int, writtenAt time.Time) {
+				err := PlayerLeftCatchUpAction(line, serverID, writtenAt)
+				if err != nil {
+					fmt.Println("ERROR WHILE PROCESSING PLAYER DISCONNECTED: " + err.Error())
+				}
+			},
 		},
 	}
 